@@ -0,0 +1,62 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidAddress = errors.New("invalid address")
+)
+
+// Address is an entry of an account's address book. Country is an ISO 3166-1
+// alpha-2 code and Region the code of a subdivision of it, e.g. "CA" in the
+// US.
+type Address struct {
+	ID         string `json:"id"`
+	AccountID  string `json:"accountId"`
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postalCode"`
+	Country    string `json:"country"`
+}
+
+// Normalize trims the fields and upper cases the country and region codes.
+func (a *Address) Normalize() {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.ToUpper(strings.TrimSpace(a.Region))
+	a.PostalCode = strings.TrimSpace(a.PostalCode)
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+}
+
+func (a Address) Validate() error {
+	switch {
+	case a.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidAddress)
+	case a.Line1 == "":
+		return fmt.Errorf("%w: line1 is required", ErrInvalidAddress)
+	case a.City == "":
+		return fmt.Errorf("%w: city is required", ErrInvalidAddress)
+	case len(a.Country) != 2:
+		return fmt.Errorf("%w: country must be a two letter code", ErrInvalidAddress)
+	}
+
+	return nil
+}
+
+// TaxRegion returns the ISO 3166-2 code of the address's region, e.g.
+// "US-CA", or just the country if it has no region.
+func (a Address) TaxRegion() string {
+	if a.Region == "" {
+		return a.Country
+	}
+
+	return a.Country + "-" + a.Region
+}
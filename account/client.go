@@ -4,6 +4,7 @@ import (
 	"context"
 
 	accountpb "github.com/azizkhan030/go-grpc-graphql/account/protos/gen"
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -14,7 +15,10 @@ type Client struct {
 }
 
 func NewClient(url string) (*Client, error) {
-	connection, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	connection, err := grpc.NewClient(url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(auth.UnaryClientInterceptor()),
+	)
 
 	if err != nil {
 		return nil, err
@@ -42,33 +46,160 @@ func (c *Client) PostAccount(ctx context.Context, name string) (*Account, error)
 }
 
 func (c *Client) GetAccount(ctx context.Context, id string) (*Account, error) {
+	a, _, err := c.GetAccountWithCursor(ctx, id)
+
+	return a, err
+}
+
+// GetAccountWithCursor also returns the cursor of the account in the listing
+// of GetAccounts, so paging can continue after it.
+func (c *Client) GetAccountWithCursor(ctx context.Context, id string) (*Account, string, error) {
 	r, err := c.service.GetAccount(ctx, &accountpb.GetAccountRequest{Id: id})
 
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	return &Account{
-		ID:   r.Account.Id,
-		Name: r.Account.Name,
-	}, nil
+		ID:      r.Account.Id,
+		Name:    r.Account.Name,
+		Email:   r.Account.Email,
+		Role:    r.Account.Role,
+		Deleted: r.Account.Deleted,
+	}, r.Cursor, nil
 }
 
-func (c *Client) GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error) {
-	r, err := c.service.GetAccounts(ctx, &accountpb.GetAccountsRequest{Skip: skip, Take: take})
+func (c *Client) GetAccounts(ctx context.Context, skip uint64, take uint64, cursor string) (*AccountPage, error) {
+	r, err := c.service.GetAccounts(ctx, &accountpb.GetAccountsRequest{Skip: skip, Take: take, Cursor: cursor})
 
 	if err != nil {
 		return nil, err
 	}
 
-	var accounts []Account
+	page := &AccountPage{
+		Cursors:    r.Cursors,
+		NextCursor: r.NextCursor,
+		TotalCount: r.TotalCount,
+	}
 
 	for _, acc := range r.Accounts {
-		accounts = append(accounts, Account{
+		page.Accounts = append(page.Accounts, Account{
 			ID:   acc.Id,
 			Name: acc.Name,
+			Role: acc.Role,
 		})
 	}
 
-	return accounts, nil
+	return page, nil
+}
+
+func (c *Client) UpdateAccount(ctx context.Context, id string, name string) (*Account, error) {
+	r, err := c.service.UpdateAccount(ctx, &accountpb.UpdateAccountRequest{Id: id, Name: name})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Account{
+		ID:   r.Account.Id,
+		Name: r.Account.Name,
+	}, nil
+}
+
+func (c *Client) DeleteAccount(ctx context.Context, id string) error {
+	_, err := c.service.DeleteAccount(ctx, &accountpb.DeleteAccountRequest{Id: id})
+
+	return err
+}
+
+func (c *Client) Register(ctx context.Context, name, email, password string) (*Account, string, error) {
+	r, err := c.service.Register(ctx, &accountpb.RegisterRequest{
+		Name:     name,
+		Email:    email,
+		Password: password,
+	})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &Account{
+		ID:    r.Account.Id,
+		Name:  r.Account.Name,
+		Email: r.Account.Email,
+		Role:  r.Account.Role,
+	}, r.AccessToken, nil
+}
+
+func (c *Client) Login(ctx context.Context, email, password string) (*Account, string, error) {
+	r, err := c.service.Login(ctx, &accountpb.LoginRequest{Email: email, Password: password})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &Account{
+		ID:    r.Account.Id,
+		Name:  r.Account.Name,
+		Email: r.Account.Email,
+		Role:  r.Account.Role,
+	}, r.AccessToken, nil
+}
+
+func (c *Client) CreateAddress(ctx context.Context, a Address) (*Address, error) {
+	r, err := c.service.CreateAddress(ctx, &accountpb.CreateAddressRequest{Address: addressOut(a)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	created := addressIn(r.Address)
+
+	return &created, nil
+}
+
+func (c *Client) GetAddress(ctx context.Context, id string) (*Address, error) {
+	r, err := c.service.GetAddress(ctx, &accountpb.GetAddressRequest{Id: id})
+
+	if err != nil {
+		return nil, err
+	}
+
+	a := addressIn(r.Address)
+
+	return &a, nil
+}
+
+func (c *Client) GetAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	r, err := c.service.GetAddresses(ctx, &accountpb.GetAddressesRequest{AccountId: accountID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := []Address{}
+
+	for _, a := range r.Addresses {
+		addresses = append(addresses, addressIn(a))
+	}
+
+	return addresses, nil
+}
+
+func (c *Client) UpdateAddress(ctx context.Context, a Address) (*Address, error) {
+	r, err := c.service.UpdateAddress(ctx, &accountpb.UpdateAddressRequest{Address: addressOut(a)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	updated := addressIn(r.Address)
+
+	return &updated, nil
+}
+
+func (c *Client) DeleteAddress(ctx context.Context, id string) error {
+	_, err := c.service.DeleteAddress(ctx, &accountpb.DeleteAddressRequest{Id: id})
+
+	return err
 }
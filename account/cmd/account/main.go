@@ -5,12 +5,15 @@ import (
 	"time"
 
 	"github.com/azizkhan030/go-grpc-graphql/account"
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
 )
 
 type Config struct {
-	DatabaseURL string `envconfig: "DATABASE_URL"`
+	DatabaseURL string        `envconfig:"DATABASE_URL"`
+	JWTSecret   string        `envconfig:"JWT_SECRET" required:"true"`
+	TokenTTL    time.Duration `envconfig:"TOKEN_TTL" default:"24h"`
 }
 
 func main() {
@@ -21,6 +24,10 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err = auth.CheckSecret(cfg.JWTSecret); err != nil {
+		log.Fatal(err)
+	}
+
 	var r account.Repository
 
 	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
@@ -37,6 +44,7 @@ func main() {
 
 	log.Println("Listening on port 8080...")
 
-	s := account.NewService(r)
-	log.Fatal(account.ListenGRPC(s, 8080))
+	tokens := auth.NewTokenIssuer(cfg.JWTSecret, cfg.TokenTTL)
+	s := account.NewService(r, tokens)
+	log.Fatal(account.ListenGRPC(s, tokens, 8080))
 }
@@ -0,0 +1,32 @@
+package account
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/segmentio/ksuid"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Cursors are opaque to clients. Account IDs are ksuids, so they sort by
+// creation time and the last ID of a page is enough to resume from.
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+
+	if _, err = ksuid.Parse(string(b)); err != nil {
+		return "", ErrInvalidCursor
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,47 @@
+package account
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
+	ErrLongPassword       = errors.New("password must be at most 72 bytes")
+)
+
+// bcrypt only hashes the first maxPasswordLength bytes of a password.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// dummyHash is compared against when logging in with an unknown email, so
+// the response takes as long as for a wrong password and doesn't reveal
+// which emails are registered.
+const dummyHash = "$2a$10$ZQi7Pg33FIENm1qkYdcCT.rEdymYOD79Wc4LXc1jU99k1SgeZ3H9C"
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", ErrWeakPassword
+	}
+
+	if len(password) > maxPasswordLength {
+		return "", ErrLongPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -3,15 +3,30 @@ package account
 import (
 	"context"
 	"database/sql"
+	"errors"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNotFound = errors.New("entity not found")
 )
 
 type Repository interface {
 	Close() error
 	PutAccount(ctx context.Context, a Account) error
 	GetAccountByID(ctx context.Context, id string) (*Account, error)
+	GetAccountByEmail(ctx context.Context, email string) (*Account, error)
 	ListAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error)
+	ListAccountsAfter(ctx context.Context, afterID string, take uint64) ([]Account, error)
+	CountAccounts(ctx context.Context) (uint64, error)
+	UpdateAccount(ctx context.Context, a Account) error
+	DeleteAccount(ctx context.Context, id string) error
+	PutAddress(ctx context.Context, a Address) error
+	GetAddressByID(ctx context.Context, id string) (*Address, error)
+	ListAddresses(ctx context.Context, accountID string) ([]Address, error)
+	UpdateAddress(ctx context.Context, a Address) error
+	DeleteAddress(ctx context.Context, id string) error
 }
 
 type dbRepository struct {
@@ -43,16 +58,53 @@ func (r *dbRepository) Ping() error {
 }
 
 func (r *dbRepository) PutAccount(ctx context.Context, a Account) error {
-	_, err := r.db.ExecContext(ctx, "INSERT INTO accounts(id, name) VALUES($1, $2)", a.ID, a.Name)
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO accounts(id, name, email, password_hash, role) VALUES($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5)",
+		a.ID,
+		a.Name,
+		a.Email,
+		a.PasswordHash,
+		a.Role,
+	)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrEmailTaken
+	}
 
 	return err
 }
 
 func (r *dbRepository) GetAccountByID(ctx context.Context, id string) (*Account, error) {
-	row := r.db.QueryRowContext(ctx, "SELECT id, name FROM account WHERE id = $1", id)
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT id, name, COALESCE(email, ''), role, deleted_at IS NOT NULL FROM accounts WHERE id = $1",
+		id,
+	)
+	a := &Account{}
+
+	if err := row.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Deleted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *dbRepository) GetAccountByEmail(ctx context.Context, email string) (*Account, error) {
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT id, name, email, password_hash, role FROM accounts WHERE email = $1 AND deleted_at IS NULL",
+		email,
+	)
 	a := &Account{}
 
-	if err := row.Scan(&a.ID, &a.Name); err != nil {
+	if err := row.Scan(&a.ID, &a.Name, &a.Email, &a.PasswordHash, &a.Role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 	return a, nil
@@ -61,7 +113,7 @@ func (r *dbRepository) GetAccountByID(ctx context.Context, id string) (*Account,
 func (r *dbRepository) ListAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error) {
 	rows, err := r.db.QueryContext(
 		ctx,
-		"SELECT id, name FROM accounts ORDER BY id DESC OFFSET $1 LIMIT $2",
+		"SELECT id, name, role FROM accounts WHERE deleted_at IS NULL ORDER BY id DESC OFFSET $1 LIMIT $2",
 		skip,
 		take,
 	)
@@ -70,6 +122,35 @@ func (r *dbRepository) ListAccounts(ctx context.Context, skip uint64, take uint6
 		return nil, err
 	}
 
+	return scanAccounts(rows)
+}
+
+// ListAccountsAfter returns the page of accounts that follows afterID in the
+// same descending ID order as ListAccounts, without scanning skipped rows.
+func (r *dbRepository) ListAccountsAfter(ctx context.Context, afterID string, take uint64) ([]Account, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT id, name, role FROM accounts WHERE deleted_at IS NULL AND id < $1 ORDER BY id DESC LIMIT $2",
+		afterID,
+		take,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAccounts(rows)
+}
+
+func (r *dbRepository) CountAccounts(ctx context.Context) (uint64, error) {
+	var count uint64
+
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM accounts WHERE deleted_at IS NULL").Scan(&count)
+
+	return count, err
+}
+
+func scanAccounts(rows *sql.Rows) ([]Account, error) {
 	defer rows.Close()
 
 	accounts := []Account{}
@@ -77,14 +158,160 @@ func (r *dbRepository) ListAccounts(ctx context.Context, skip uint64, take uint6
 	for rows.Next() {
 		a := &Account{}
 
-		if err = rows.Scan(&a.ID, &a.Name); err == nil {
+		if err := rows.Scan(&a.ID, &a.Name, &a.Role); err == nil {
 			accounts = append(accounts, *a)
 		}
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return accounts, nil
 }
+
+func (r *dbRepository) UpdateAccount(ctx context.Context, a Account) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		"UPDATE accounts SET name = $2 WHERE id = $1 AND deleted_at IS NULL",
+		a.ID,
+		a.Name,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// DeleteAccount soft-deletes an account, so the orders placed with it keep
+// their account. Its credentials are cleared, which also frees its email
+// for a new account.
+func (r *dbRepository) DeleteAccount(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		"UPDATE accounts SET deleted_at = NOW(), email = NULL, password_hash = NULL WHERE id = $1 AND deleted_at IS NULL",
+		id,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *dbRepository) PutAddress(ctx context.Context, a Address) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO addresses(id, account_id, name, line1, line2, city, region, postal_code, country)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		a.ID,
+		a.AccountID,
+		a.Name,
+		a.Line1,
+		a.Line2,
+		a.City,
+		a.Region,
+		a.PostalCode,
+		a.Country,
+	)
+
+	return err
+}
+
+func (r *dbRepository) GetAddressByID(ctx context.Context, id string) (*Address, error) {
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT id, account_id, name, line1, line2, city, region, postal_code, country FROM addresses WHERE id = $1",
+		id,
+	)
+	a := &Address{}
+
+	if err := row.Scan(&a.ID, &a.AccountID, &a.Name, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *dbRepository) ListAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT id, account_id, name, line1, line2, city, region, postal_code, country FROM addresses WHERE account_id = $1 ORDER BY id",
+		accountID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	addresses := []Address{}
+
+	for rows.Next() {
+		a := Address{}
+
+		if err := rows.Scan(&a.ID, &a.AccountID, &a.Name, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country); err != nil {
+			return nil, err
+		}
+
+		addresses = append(addresses, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+func (r *dbRepository) UpdateAddress(ctx context.Context, a Address) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`UPDATE addresses SET name = $2, line1 = $3, line2 = $4, city = $5, region = $6, postal_code = $7, country = $8
+		WHERE id = $1`,
+		a.ID,
+		a.Name,
+		a.Line1,
+		a.Line2,
+		a.City,
+		a.Region,
+		a.PostalCode,
+		a.Country,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *dbRepository) DeleteAddress(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM addresses WHERE id = $1", id)
+
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
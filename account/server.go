@@ -2,12 +2,16 @@ package account
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 
 	accountpb "github.com/azizkhan030/go-grpc-graphql/account/protos/gen"
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
@@ -15,14 +19,22 @@ type grpcServer struct {
 	service Service
 }
 
-func ListenGRPC(s Service, port int) error {
+var policy = auth.Policy{
+	accountpb.AccountService_PostAccount_FullMethodName: auth.Public,
+	accountpb.AccountService_Register_FullMethodName:    auth.Public,
+	accountpb.AccountService_Login_FullMethodName:       auth.Public,
+	accountpb.AccountService_GetAccount_FullMethodName:  auth.RoleCustomer,
+	accountpb.AccountService_GetAccounts_FullMethodName: auth.RoleAdmin,
+}
+
+func ListenGRPC(s Service, tokens *auth.TokenIssuer, port int) error {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 
 	if err != nil {
 		return err
 	}
 
-	server := grpc.NewServer()
+	server := grpc.NewServer(grpc.UnaryInterceptor(auth.UnaryServerInterceptor(tokens, policy)))
 	accountpb.RegisterAccountServiceServer(server, &grpcServer{accountpb.UnimplementedAccountServiceServer{}, s})
 	reflection.Register(server)
 
@@ -39,40 +51,265 @@ func (s *grpcServer) PostAccount(ctx context.Context, r *accountpb.PostAccountRe
 		Account: &accountpb.Account{
 			Id:   acc.ID,
 			Name: acc.Name,
+			Role: acc.Role,
 		},
 	}, nil
 }
 
 func (s *grpcServer) GetAccount(ctx context.Context, r *accountpb.GetAccountRequest) (*accountpb.GetAccountResponse, error) {
+	if !auth.CanActFor(ctx, r.Id) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
 	acc, err := s.service.GetAccount(ctx, r.Id)
 
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 
 	return &accountpb.GetAccountResponse{
-		Account: &accountpb.Account{
-			Id:   acc.ID,
-			Name: acc.Name,
-		},
+		Account: accountOut(*acc),
+		Cursor:  encodeCursor(acc.ID),
 	}, nil
 }
 
+func accountOut(a Account) *accountpb.Account {
+	return &accountpb.Account{
+		Id:      a.ID,
+		Name:    a.Name,
+		Email:   a.Email,
+		Role:    a.Role,
+		Deleted: a.Deleted,
+	}
+}
+
 func (s *grpcServer) GetAccounts(ctx context.Context, r *accountpb.GetAccountsRequest) (*accountpb.GetAccountsResponse, error) {
-	accs, err := s.service.GetAccounts(ctx, r.Skip, r.Take)
+	page, err := s.service.GetAccounts(ctx, r.Skip, r.Take, r.Cursor)
 
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 
 	accounts := []*accountpb.Account{}
 
-	for _, acc := range accs {
+	for _, acc := range page.Accounts {
 		accounts = append(accounts, &accountpb.Account{
 			Id:   acc.ID,
 			Name: acc.Name,
+			Role: acc.Role,
 		})
 	}
 
-	return &accountpb.GetAccountsResponse{Accounts: accounts}, nil
+	return &accountpb.GetAccountsResponse{
+		Accounts:   accounts,
+		NextCursor: page.NextCursor,
+		TotalCount: page.TotalCount,
+		Cursors:    page.Cursors,
+	}, nil
+}
+
+func (s *grpcServer) UpdateAccount(ctx context.Context, r *accountpb.UpdateAccountRequest) (*accountpb.UpdateAccountResponse, error) {
+	if !auth.CanActFor(ctx, r.Id) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	acc, err := s.service.UpdateAccount(ctx, r.Id, r.Name)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &accountpb.UpdateAccountResponse{
+		Account: accountOut(*acc),
+	}, nil
+}
+
+func (s *grpcServer) DeleteAccount(ctx context.Context, r *accountpb.DeleteAccountRequest) (*accountpb.DeleteAccountResponse, error) {
+	if !auth.CanActFor(ctx, r.Id) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	if err := s.service.DeleteAccount(ctx, r.Id); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &accountpb.DeleteAccountResponse{}, nil
+}
+
+func (s *grpcServer) Register(ctx context.Context, r *accountpb.RegisterRequest) (*accountpb.RegisterResponse, error) {
+	acc, token, err := s.service.Register(ctx, r.Name, r.Email, r.Password)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &accountpb.RegisterResponse{
+		Account: &accountpb.Account{
+			Id:    acc.ID,
+			Name:  acc.Name,
+			Email: acc.Email,
+			Role:  acc.Role,
+		},
+		AccessToken: token,
+	}, nil
+}
+
+func (s *grpcServer) Login(ctx context.Context, r *accountpb.LoginRequest) (*accountpb.LoginResponse, error) {
+	acc, token, err := s.service.Login(ctx, r.Email, r.Password)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &accountpb.LoginResponse{
+		Account: &accountpb.Account{
+			Id:    acc.ID,
+			Name:  acc.Name,
+			Email: acc.Email,
+			Role:  acc.Role,
+		},
+		AccessToken: token,
+	}, nil
+}
+
+func (s *grpcServer) CreateAddress(ctx context.Context, r *accountpb.CreateAddressRequest) (*accountpb.CreateAddressResponse, error) {
+	a := addressIn(r.Address)
+
+	if !auth.CanActFor(ctx, a.AccountID) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	created, err := s.service.CreateAddress(ctx, a)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &accountpb.CreateAddressResponse{Address: addressOut(*created)}, nil
+}
+
+func (s *grpcServer) GetAddress(ctx context.Context, r *accountpb.GetAddressRequest) (*accountpb.GetAddressResponse, error) {
+	a, err := s.ownAddress(ctx, r.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountpb.GetAddressResponse{Address: addressOut(*a)}, nil
+}
+
+func (s *grpcServer) GetAddresses(ctx context.Context, r *accountpb.GetAddressesRequest) (*accountpb.GetAddressesResponse, error) {
+	if !auth.CanActFor(ctx, r.AccountId) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	addresses, err := s.service.GetAddresses(ctx, r.AccountId)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &accountpb.GetAddressesResponse{Addresses: []*accountpb.Address{}}
+
+	for _, a := range addresses {
+		res.Addresses = append(res.Addresses, addressOut(a))
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) UpdateAddress(ctx context.Context, r *accountpb.UpdateAddressRequest) (*accountpb.UpdateAddressResponse, error) {
+	a := addressIn(r.Address)
+	current, err := s.ownAddress(ctx, a.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	a.AccountID = current.AccountID
+	updated, err := s.service.UpdateAddress(ctx, a)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &accountpb.UpdateAddressResponse{Address: addressOut(*updated)}, nil
+}
+
+func (s *grpcServer) DeleteAddress(ctx context.Context, r *accountpb.DeleteAddressRequest) (*accountpb.DeleteAddressResponse, error) {
+	if _, err := s.ownAddress(ctx, r.Id); err != nil {
+		return nil, err
+	}
+
+	if err := s.service.DeleteAddress(ctx, r.Id); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &accountpb.DeleteAddressResponse{}, nil
+}
+
+// ownAddress looks up an address the caller may act on. Addresses of other
+// accounts are reported as not found, so their IDs can't be probed.
+func (s *grpcServer) ownAddress(ctx context.Context, id string) (*Address, error) {
+	a, err := s.service.GetAddress(ctx, id)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	if !auth.CanActFor(ctx, a.AccountID) {
+		return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+	}
+
+	return a, nil
+}
+
+func addressIn(a *accountpb.Address) Address {
+	if a == nil {
+		return Address{}
+	}
+
+	return Address{
+		ID:         a.Id,
+		AccountID:  a.AccountId,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func addressOut(a Address) *accountpb.Address {
+	return &accountpb.Address{
+		Id:         a.ID,
+		AccountId:  a.AccountID,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, ErrEmailTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrWeakPassword),
+		errors.Is(err, ErrLongPassword),
+		errors.Is(err, ErrInvalidCursor),
+		errors.Is(err, ErrInvalidAddress):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return err
 }
@@ -2,33 +2,60 @@ package account
 
 import (
 	"context"
+	"errors"
+	"strings"
 
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	"github.com/segmentio/ksuid"
 )
 
 type Service interface {
 	PostAccount(ctx context.Context, name string) (*Account, error)
 	GetAccount(ctx context.Context, id string) (*Account, error)
-	GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error)
+	GetAccounts(ctx context.Context, skip uint64, take uint64, cursor string) (*AccountPage, error)
+	UpdateAccount(ctx context.Context, id string, name string) (*Account, error)
+	DeleteAccount(ctx context.Context, id string) error
+	Register(ctx context.Context, name, email, password string) (*Account, string, error)
+	Login(ctx context.Context, email, password string) (*Account, string, error)
+	CreateAddress(ctx context.Context, a Address) (*Address, error)
+	GetAddress(ctx context.Context, id string) (*Address, error)
+	GetAddresses(ctx context.Context, accountID string) ([]Address, error)
+	UpdateAddress(ctx context.Context, a Address) (*Address, error)
+	DeleteAddress(ctx context.Context, id string) error
 }
 
 type Account struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	Deleted      bool   `json:"deleted"`
+}
+
+// AccountPage is a single page of a listing. Cursors holds the cursor of
+// each account, in the same order.
+type AccountPage struct {
+	Accounts   []Account
+	Cursors    []string
+	NextCursor string
+	TotalCount uint64
 }
 
 type accountService struct {
 	repository Repository
+	tokens     *auth.TokenIssuer
 }
 
-func NewService(r Repository) Service {
-	return &accountService{r}
+func NewService(r Repository, t *auth.TokenIssuer) Service {
+	return &accountService{r, t}
 }
 
 func (s *accountService) PostAccount(ctx context.Context, name string) (*Account, error) {
 	acc := &Account{
 		Name: name,
 		ID:   ksuid.New().String(),
+		Role: auth.RoleCustomer,
 	}
 
 	err := s.repository.PutAccount(ctx, *acc)
@@ -44,10 +71,179 @@ func (s *accountService) GetAccount(ctx context.Context, id string) (*Account, e
 	return s.repository.GetAccountByID(ctx, id)
 }
 
-func (s *accountService) GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error) {
+// GetAccounts returns a page of accounts along with the cursor of every
+// account in it. A non-empty cursor takes precedence over skip; the next
+// cursor is empty once the last page has been reached.
+func (s *accountService) GetAccounts(ctx context.Context, skip uint64, take uint64, cursor string) (*AccountPage, error) {
 	if take > 100 || (skip == 0 && take == 0) {
 		take = 100
 	}
 
-	return s.repository.ListAccounts(ctx, skip, take)
+	var accounts []Account
+	var err error
+
+	// One extra row tells whether another page follows
+	if cursor != "" {
+		afterID, cursorErr := decodeCursor(cursor)
+
+		if cursorErr != nil {
+			return nil, cursorErr
+		}
+
+		accounts, err = s.repository.ListAccountsAfter(ctx, afterID, take+1)
+	} else {
+		accounts, err = s.repository.ListAccounts(ctx, skip, take+1)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.repository.CountAccounts(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AccountPage{TotalCount: total}
+
+	if uint64(len(accounts)) > take {
+		accounts = accounts[:take]
+		page.NextCursor = encodeCursor(accounts[len(accounts)-1].ID)
+	}
+
+	page.Accounts = accounts
+
+	for _, a := range accounts {
+		page.Cursors = append(page.Cursors, encodeCursor(a.ID))
+	}
+
+	return page, nil
+}
+
+func (s *accountService) UpdateAccount(ctx context.Context, id string, name string) (*Account, error) {
+	err := s.repository.UpdateAccount(ctx, Account{ID: id, Name: name})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetAccountByID(ctx, id)
+}
+
+// DeleteAccount soft deletes the account, so it can still be looked up by ID
+// (e.g. from existing orders) but no longer shows up in listings.
+func (s *accountService) DeleteAccount(ctx context.Context, id string) error {
+	return s.repository.DeleteAccount(ctx, id)
+}
+
+func (s *accountService) Register(ctx context.Context, name, email, password string) (*Account, string, error) {
+	hash, err := hashPassword(password)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	acc := &Account{
+		ID:           ksuid.New().String(),
+		Name:         name,
+		Email:        strings.ToLower(strings.TrimSpace(email)),
+		PasswordHash: hash,
+		Role:         auth.RoleCustomer,
+	}
+
+	if err = s.repository.PutAccount(ctx, *acc); err != nil {
+		return nil, "", err
+	}
+
+	token, err := s.tokens.Issue(acc.ID, acc.Role)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return acc, token, nil
+}
+
+func (s *accountService) Login(ctx context.Context, email, password string) (*Account, string, error) {
+	// Longer passwords would match any password they start with
+	if len(password) > maxPasswordLength {
+		return nil, "", ErrLongPassword
+	}
+
+	acc, err := s.repository.GetAccountByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+
+	if errors.Is(err, ErrNotFound) {
+		checkPassword(dummyHash, password)
+		return nil, "", ErrInvalidCredentials
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !checkPassword(acc.PasswordHash, password) {
+		return nil, "", ErrInvalidCredentials
+	}
+
+	token, err := s.tokens.Issue(acc.ID, acc.Role)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return acc, token, nil
+}
+
+func (s *accountService) CreateAddress(ctx context.Context, a Address) (*Address, error) {
+	a.Normalize()
+
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+
+	acc, err := s.repository.GetAccountByID(ctx, a.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.Deleted {
+		return nil, ErrNotFound
+	}
+
+	a.ID = ksuid.New().String()
+
+	if err = s.repository.PutAddress(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *accountService) GetAddress(ctx context.Context, id string) (*Address, error) {
+	return s.repository.GetAddressByID(ctx, id)
+}
+
+func (s *accountService) GetAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	return s.repository.ListAddresses(ctx, accountID)
+}
+
+// UpdateAddress replaces every field of the address but its account.
+func (s *accountService) UpdateAddress(ctx context.Context, a Address) (*Address, error) {
+	a.Normalize()
+
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.UpdateAddress(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetAddressByID(ctx, a.ID)
+}
+
+func (s *accountService) DeleteAddress(ctx context.Context, id string) error {
+	return s.repository.DeleteAddress(ctx, id)
 }
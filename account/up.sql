@@ -1,5 +1,22 @@
 CREATE TABLE IF NOT EXISTS accounts (
     id CHAR(27) PRIMARY KEY,
-    name VARCHAR(24) NOT NULL
+    name VARCHAR(24) NOT NULL,
+    email VARCHAR(254) UNIQUE,
+    password_hash CHAR(60),
+    role VARCHAR(16) NOT NULL DEFAULT 'customer' CHECK (role IN ('customer', 'admin')),
+    deleted_at TIMESTAMP WITH TIME ZONE
 );
 
+CREATE TABLE IF NOT EXISTS addresses (
+    id CHAR(27) PRIMARY KEY,
+    account_id CHAR(27) NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL,
+    region VARCHAR(16) NOT NULL DEFAULT '',
+    postal_code VARCHAR(16) NOT NULL DEFAULT '',
+    country CHAR(2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS addresses_account_id_idx ON addresses (account_id);
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+)
+
+type contextKey string
+
+const (
+	claimsKey contextKey = "claims"
+	tokenKey  contextKey = "token"
+)
+
+// WithClaims attaches a verified token and its claims to the context, so
+// outgoing gRPC calls made with it act on behalf of the same caller.
+func WithClaims(ctx context.Context, token string, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, tokenKey, token)
+
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*Claims)
+
+	return claims, ok && claims != nil
+}
+
+func tokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenKey).(string)
+
+	return token, ok && token != ""
+}
+
+// CanActFor reports whether the caller is the given account or an admin.
+func CanActFor(ctx context.Context, accountID string) bool {
+	claims, ok := ClaimsFromContext(ctx)
+
+	if !ok {
+		return false
+	}
+
+	return claims.Role == RoleAdmin || claims.AccountID() == accountID
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const authorizationHeader = "authorization"
+
+// Public marks a method in a Policy that can be called without a token.
+const Public = ""
+
+// Policy maps full gRPC method names to the role required to call them.
+// Methods missing from the policy require an authenticated caller.
+type Policy map[string]string
+
+// UnaryClientInterceptor forwards the caller's access token, if any, as
+// gRPC metadata on every outgoing call.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if token, ok := tokenFromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, authorizationHeader, "Bearer "+token)
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// UnaryServerInterceptor verifies the access token sent in the metadata and
+// enforces the role the policy requires for the called method.
+func UnaryServerInterceptor(tokens *TokenIssuer, policy Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		role, ok := policy[info.FullMethod]
+
+		if !ok {
+			role = RoleCustomer
+		}
+
+		token, found := tokenFromMetadata(ctx)
+
+		if !found {
+			if role == Public {
+				return handler(ctx, req)
+			}
+			return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+		}
+
+		claims, err := tokens.Verify(token)
+
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		if role != Public && !claims.HasRole(role) {
+			return nil, status.Error(codes.PermissionDenied, ErrForbidden.Error())
+		}
+
+		return handler(WithClaims(ctx, token, claims), req)
+	}
+}
+
+func tokenFromMetadata(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+
+	if !ok {
+		return "", false
+	}
+
+	for _, v := range md.Get(authorizationHeader) {
+		if token, ok := strings.CutPrefix(v, "Bearer "); ok && token != "" {
+			return token, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken    = errors.New("invalid access token")
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+	ErrWeakSecret      = errors.New("JWT_SECRET must be set to a secret of your own")
+)
+
+// placeholderSecret is the secret docker-compose.yaml used to set.
+// Anyone could forge tokens signed with it.
+const placeholderSecret = "change-me"
+
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+	// RoleService is held by the services themselves, for calls that only
+	// make sense as part of another operation, e.g. reserving stock for an
+	// order being placed.
+	RoleService = "service"
+)
+
+// serviceTokenTTL is the lifetime of the tokens services issue themselves,
+// which only need to outlive a single call.
+const serviceTokenTTL = time.Minute
+
+// Claims is the payload of an access token issued by the account service.
+// The subject is the ID of the authenticated account.
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+func (c Claims) AccountID() string {
+	return c.Subject
+}
+
+// HasRole reports whether the claims satisfy the given role. Admins satisfy
+// every role.
+func (c Claims) HasRole(role string) bool {
+	return c.Role == RoleAdmin || c.Role == role
+}
+
+// TokenIssuer signs and verifies HS256 access tokens. Every service must be
+// configured with the same secret.
+type TokenIssuer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// CheckSecret rejects secrets that must not sign tokens. Services refuse to
+// start with them.
+func CheckSecret(secret string) error {
+	if secret == "" || secret == placeholderSecret {
+		return ErrWeakSecret
+	}
+
+	return nil
+}
+
+func NewTokenIssuer(secret string, ttl time.Duration) *TokenIssuer {
+	return &TokenIssuer{[]byte(secret), ttl}
+}
+
+func (t *TokenIssuer) Issue(accountID, role string) (string, error) {
+	token, _, err := t.issue(accountID, role, t.ttl)
+
+	return token, err
+}
+
+// ServiceContext returns a context acting as the named service instead of
+// the caller, for outgoing calls that require RoleService.
+func (t *TokenIssuer) ServiceContext(ctx context.Context, service string) (context.Context, error) {
+	token, claims, err := t.issue(service, RoleService, serviceTokenTTL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return WithClaims(ctx, token, claims), nil
+}
+
+func (t *TokenIssuer) issue(subject, role string, ttl time.Duration) (string, *Claims, error) {
+	now := time.Now().UTC()
+	claims := &Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, claims, nil
+}
+
+func (t *TokenIssuer) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(
+		token,
+		claims,
+		func(_ *jwt.Token) (interface{}, error) {
+			return t.secret, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,362 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidCategory = errors.New("invalid category")
+	ErrUnknownCategory = errors.New("unknown category")
+	ErrCategoryExists  = errors.New("category already exists")
+	ErrCategoryInUse   = errors.New("category has subcategories or products")
+)
+
+// Category is a node of the category tree. Path holds the slugs from the
+// root down to the category, joined by "/". Categories can't be moved, so
+// the paths stored with products never go stale.
+type Category struct {
+	Slug   string `json:"slug"`
+	Name   string `json:"name"`
+	Parent string `json:"parent"`
+	Path   string `json:"path"`
+}
+
+// maxCategoryDepth bounds the levels of the category tree.
+const maxCategoryDepth = 8
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Ancestors returns the slugs of the category and of the categories above
+// it, from the root down.
+func (c Category) Ancestors() []string {
+	return strings.Split(c.Path, "/")
+}
+
+// categoryTree returns the slugs of the categories and all their ancestors.
+// Products are indexed with it, so filtering by a category also matches the
+// products of its subcategories.
+func categoryTree(categories []Category) []string {
+	tree := []string{}
+	seen := map[string]bool{}
+
+	for _, c := range categories {
+		for _, slug := range c.Ancestors() {
+			if !seen[slug] {
+				seen[slug] = true
+				tree = append(tree, slug)
+			}
+		}
+	}
+
+	return tree
+}
+
+// categoryMapping maps Category. Parents and paths are matched exactly, so
+// they are keywords.
+var categoryMapping = indexMapping{
+	Dynamic: "strict",
+	Properties: map[string]fieldMapping{
+		"slug":   {Type: "keyword"},
+		"name":   {Type: "text"},
+		"parent": {Type: "keyword"},
+		"path":   {Type: "keyword"},
+	},
+}
+
+// categoriesIndex holds the category tree, one document per category keyed
+// by its slug.
+func (r *elasticRepository) categoriesIndex() string {
+	return r.index + "_categories"
+}
+
+// ensureCategoriesIndex creates the categories index unless it exists.
+func (r *elasticRepository) ensureCategoriesIndex(ctx context.Context) error {
+	b, err := json.Marshal(map[string]interface{}{"mappings": categoryMapping})
+	if err != nil {
+		return err
+	}
+
+	res, err := r.client.Indices.Create(
+		r.categoriesIndex(),
+		r.client.Indices.Create.WithBody(bytes.NewReader(b)),
+		r.client.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 400 && strings.Contains(res.String(), "resource_already_exists_exception") {
+		return nil
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("error creating categories index: %s", res.String())
+	}
+
+	return nil
+}
+
+// PutCategory stores a new category, failing with ErrCategoryExists if its
+// slug is taken.
+func (r *elasticRepository) PutCategory(ctx context.Context, c Category) error {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.client.Create(
+		r.categoriesIndex(),
+		c.Slug,
+		bytes.NewReader(body),
+		r.client.Create.WithRefresh("true"),
+		r.client.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 409 {
+		return ErrCategoryExists
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("error indexing category: %s", res.String())
+	}
+
+	return nil
+}
+
+func (r *elasticRepository) GetCategory(ctx context.Context, slug string) (*Category, error) {
+	res, err := r.client.Get(
+		r.categoriesIndex(),
+		slug,
+		r.client.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil, ErrNotFound
+	}
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error getting category: %s", res.String())
+	}
+
+	var doc struct {
+		Source Category `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return &doc.Source, nil
+}
+
+// maxCategories bounds the categories returned by a single listing.
+const maxCategories = 1000
+
+// ListCategories returns the children of the parents, the top-level
+// categories for an empty parent, sorted by path.
+func (r *elasticRepository) ListCategories(ctx context.Context, parents []string) ([]Category, error) {
+	return r.searchCategories(ctx, map[string]interface{}{
+		"terms": map[string]interface{}{"parent": parents},
+	})
+}
+
+// ListCategoriesWithSlugs returns the categories with the given slugs that
+// exist, sorted by path.
+func (r *elasticRepository) ListCategoriesWithSlugs(ctx context.Context, slugs []string) ([]Category, error) {
+	return r.searchCategories(ctx, map[string]interface{}{
+		"ids": map[string]interface{}{"values": slugs},
+	})
+}
+
+func (r *elasticRepository) searchCategories(ctx context.Context, query map[string]interface{}) ([]Category, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"size":  maxCategories,
+		"query": query,
+		"sort": []interface{}{
+			map[string]interface{}{"path": "asc"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(r.categoriesIndex()),
+		r.client.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error searching categories: %s", res.String())
+	}
+
+	var searchResult struct {
+		Hits struct {
+			Hits []struct {
+				Source Category `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&searchResult); err != nil {
+		return nil, err
+	}
+
+	categories := make([]Category, 0, len(searchResult.Hits.Hits))
+
+	for _, hit := range searchResult.Hits.Hits {
+		categories = append(categories, hit.Source)
+	}
+
+	return categories, nil
+}
+
+func (r *elasticRepository) DeleteCategory(ctx context.Context, slug string) error {
+	res, err := r.client.Delete(
+		r.categoriesIndex(),
+		slug,
+		r.client.Delete.WithRefresh("true"),
+		r.client.Delete.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return ErrNotFound
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("error deleting category: %s", res.String())
+	}
+
+	return nil
+}
+
+// CountProductsInCategory counts the products in the category or any of its
+// subcategories.
+func (r *elasticRepository) CountProductsInCategory(ctx context.Context, slug string) (uint64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"category_tree": slug},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := r.client.Count(
+		r.client.Count.WithContext(ctx),
+		r.client.Count.WithIndex(r.index),
+		r.client.Count.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, fmt.Errorf("error counting products: %s", res.String())
+	}
+
+	var count struct {
+		Count uint64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&count); err != nil {
+		return 0, err
+	}
+
+	return count.Count, nil
+}
+
+// SetProductCategories replaces the categories of a product and its category
+// tree.
+func (r *elasticRepository) SetProductCategories(ctx context.Context, id string, categories, tree []string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"doc": map[string]interface{}{"categories": categories, "category_tree": tree},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := r.client.Update(
+		r.index,
+		id,
+		bytes.NewReader(body),
+		r.client.Update.WithRetryOnConflict(updateRetries),
+		r.client.Update.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return ErrNotFound
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("error updating categories: %s", res.String())
+	}
+
+	return nil
+}
+
+// backfillCategoryTrees indexes the category tree of the products indexed
+// before categories formed a tree. Categories missing from the tree are kept
+// as they are, so filtering by them still matches.
+func (r *elasticRepository) backfillCategoryTrees(ctx context.Context) error {
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter":   map[string]interface{}{"exists": map[string]interface{}{"field": "categories"}},
+			"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": "category_tree"}},
+		},
+	}
+
+	known := map[string]Category{}
+
+	return r.updateProducts(ctx, query, []string{"categories"}, func(doc productDocument) (map[string]interface{}, error) {
+		assigned := []Category{}
+
+		for _, slug := range doc.Categories {
+			c, ok := known[slug]
+
+			if !ok {
+				found, err := r.GetCategory(ctx, slug)
+
+				switch {
+				case errors.Is(err, ErrNotFound):
+					c = Category{Slug: slug, Path: slug}
+				case err != nil:
+					return nil, err
+				default:
+					c = *found
+				}
+
+				known[slug] = c
+			}
+
+			assigned = append(assigned, c)
+		}
+
+		return map[string]interface{}{"category_tree": categoryTree(assigned)}, nil
+	})
+}
@@ -3,7 +3,10 @@ package catalog
 import (
 	"context"
 
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	pb "github.com/azizkhan030/go-grpc-graphql/catalog/protos/gen"
+	"github.com/azizkhan030/go-grpc-graphql/money"
+	moneypb "github.com/azizkhan030/go-grpc-graphql/money/protos/gen"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -14,7 +17,10 @@ type Client struct {
 }
 
 func NewClient(url string) (*Client, error) {
-	connection, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	connection, err := grpc.NewClient(url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(auth.UnaryClientInterceptor()),
+	)
 
 	if err != nil {
 		return nil, err
@@ -32,63 +38,282 @@ func (c *Client) Close() {
 	c.connection.Close()
 }
 
-func (c *Client) PostProduct(ctx context.Context, name, description string, price float64) (*Product, error) {
+func (c *Client) PostProduct(ctx context.Context, name, description, taxCategory string, categories []string, price money.Money, prices []money.Money, stock uint32) (*Product, error) {
+	protoPrices := []*moneypb.Money{}
+
+	for _, p := range prices {
+		protoPrices = append(protoPrices, p.Proto())
+	}
+
 	r, err := c.service.PostProduct(ctx,
 		&pb.PostProductRequest{
 			Name:        name,
 			Description: description,
-			Price:       price,
+			Price:       price.Proto(),
+			Prices:      protoPrices,
+			Stock:       stock,
+			TaxCategory: taxCategory,
+			Categories:  categories,
 		})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &Product{
-		ID:    r.Product.Id,
-		Name:  r.Product.Description,
-		Price: r.Product.Price,
-	}, nil
+	p := productFromProto(r.Product)
+
+	return &p, nil
 }
 
-func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
+func (c *Client) GetProduct(ctx context.Context, id, currency string) (*Product, error) {
 	r, err := c.service.GetProduct(ctx, &pb.GetProductRequest{
-		Id: id,
+		Id:       id,
+		Currency: currency,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := productFromProto(r.Product)
+
+	return &p, nil
+}
+
+func (c *Client) GetProducts(ctx context.Context, query string, ids []string, take uint64, skip uint64, cursor, currency string) (*ProductPage, error) {
+	r, err := c.service.GetProducts(ctx, &pb.GetProductsRequest{
+		Ids:      ids,
+		Take:     take,
+		Skip:     skip,
+		Query:    query,
+		Cursor:   cursor,
+		Currency: currency,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &Product{
-		ID:    r.Product.Id,
-		Name:  r.Product.Description,
-		Price: r.Product.Price,
-	}, nil
+	return pageFromProto(r), nil
 }
 
-func (c *Client) GetProducts(ctx context.Context, query string, ids []string, take uint64, skip uint64) ([]*Product, error) {
+// SearchProducts returns a page of the products matching the search, with
+// its facets.
+func (c *Client) SearchProducts(ctx context.Context, s ProductSearch, take uint64, skip uint64, cursor, currency string) (*ProductPage, error) {
 	r, err := c.service.GetProducts(ctx, &pb.GetProductsRequest{
-		Ids:   ids,
-		Take:  take,
-		Skip:  skip,
-		Query: query,
+		Query: s.Query,
+		Filter: &pb.ProductFilter{
+			Categories: s.Filter.Categories,
+			MinPrice:   moneyOut(s.Filter.MinPrice),
+			MaxPrice:   moneyOut(s.Filter.MaxPrice),
+			InStock:    s.Filter.InStock,
+		},
+		Sort:     string(s.Sort),
+		Take:     take,
+		Skip:     skip,
+		Cursor:   cursor,
+		Currency: currency,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	products := []*Product{}
+	return pageFromProto(r), nil
+}
+
+func (c *Client) SetExchangeRate(ctx context.Context, from, to, rate string) (*money.Rate, error) {
+	r, err := c.service.SetExchangeRate(ctx, &pb.SetExchangeRateRequest{
+		Rate: &pb.ExchangeRate{From: from, To: to, Rate: rate},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &money.Rate{From: r.Rate.From, To: r.Rate.To, Value: r.Rate.Rate}, nil
+}
+
+func (c *Client) PostCategory(ctx context.Context, name, slug, parent string) (*Category, error) {
+	r, err := c.service.PostCategory(ctx, &pb.PostCategoryRequest{Name: name, Slug: slug, Parent: parent})
+
+	if err != nil {
+		return nil, err
+	}
+
+	category := categoryFromProto(r.Category)
+
+	return &category, nil
+}
+
+func (c *Client) GetCategory(ctx context.Context, slug string) (*Category, error) {
+	r, err := c.service.GetCategory(ctx, &pb.GetCategoryRequest{Slug: slug})
+
+	if err != nil {
+		return nil, err
+	}
+
+	category := categoryFromProto(r.Category)
+
+	return &category, nil
+}
+
+// GetCategories returns the subcategories of parent, or the top-level
+// categories if it's empty.
+func (c *Client) GetCategories(ctx context.Context, parent string) ([]Category, error) {
+	return c.getCategories(ctx, &pb.GetCategoriesRequest{Parent: parent})
+}
+
+// GetSubcategories returns the subcategories of every parent with a single
+// call.
+func (c *Client) GetSubcategories(ctx context.Context, parents []string) ([]Category, error) {
+	return c.getCategories(ctx, &pb.GetCategoriesRequest{Parents: parents})
+}
+
+// GetCategoriesWithSlugs returns the categories with the given slugs with a
+// single call, leaving out the ones that don't exist.
+func (c *Client) GetCategoriesWithSlugs(ctx context.Context, slugs []string) ([]Category, error) {
+	return c.getCategories(ctx, &pb.GetCategoriesRequest{Slugs: slugs})
+}
+
+func (c *Client) getCategories(ctx context.Context, req *pb.GetCategoriesRequest) ([]Category, error) {
+	r, err := c.service.GetCategories(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []Category{}
+
+	for _, category := range r.Categories {
+		categories = append(categories, categoryFromProto(category))
+	}
+
+	return categories, nil
+}
+
+func (c *Client) DeleteCategory(ctx context.Context, slug string) error {
+	_, err := c.service.DeleteCategory(ctx, &pb.DeleteCategoryRequest{Slug: slug})
+
+	return err
+}
+
+// SetProductCategories replaces the categories of a product.
+func (c *Client) SetProductCategories(ctx context.Context, id string, categories []string) (*Product, error) {
+	r, err := c.service.SetProductCategories(ctx, &pb.SetProductCategoriesRequest{Id: id, Categories: categories})
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := productFromProto(r.Product)
+
+	return &p, nil
+}
+
+func categoryFromProto(c *pb.Category) Category {
+	return Category{Slug: c.Slug, Name: c.Name, Parent: c.Parent, Path: c.Path}
+}
+
+// SuggestProducts returns up to limit product names completing prefix, best
+// matches first.
+func (c *Client) SuggestProducts(ctx context.Context, prefix string, limit uint32) ([]Suggestion, error) {
+	r, err := c.service.SuggestProducts(ctx, &pb.SuggestProductsRequest{Prefix: prefix, Limit: limit})
+
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []Suggestion{}
+
+	for _, s := range r.Suggestions {
+		suggestions = append(suggestions, Suggestion{Text: s.Text, ProductID: s.ProductId})
+	}
+
+	return suggestions, nil
+}
+
+func pageFromProto(r *pb.GetProductsResponse) *ProductPage {
+	page := &ProductPage{
+		Cursors:    r.Cursors,
+		NextCursor: r.NextCursor,
+		TotalCount: r.TotalCount,
+	}
 
 	for _, p := range r.Products {
-		products = append(products, &Product{
-			ID:          p.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		})
+		page.Products = append(page.Products, productFromProto(p))
+	}
+
+	for _, f := range r.Facets {
+		facet := Facet{Name: f.Name, Buckets: []FacetBucket{}}
+
+		for _, b := range f.Buckets {
+			facet.Buckets = append(facet.Buckets, FacetBucket{
+				Key:   b.Key,
+				Count: b.Count,
+				From:  money.FromProto(b.From),
+				To:    money.FromProto(b.To),
+			})
+		}
+
+		page.Facets = append(page.Facets, facet)
+	}
+
+	return page
+}
+
+// moneyOut leaves unset amounts out of a request.
+func moneyOut(m money.Money) *moneypb.Money {
+	if m.Currency == "" {
+		return nil
+	}
+
+	return m.Proto()
+}
+
+func productFromProto(p *pb.Product) Product {
+	product := Product{
+		ID:           p.Id,
+		Name:         p.Name,
+		Description:  p.Description,
+		Price:        money.FromProto(p.Price),
+		ExchangeRate: p.ExchangeRate,
+		Stock:        p.Stock,
+		TaxCategory:  p.TaxCategory,
+		Categories:   p.Categories,
+	}
+
+	for _, price := range p.Prices {
+		product.Prices = append(product.Prices, money.FromProto(price))
+	}
+
+	return product
+}
+
+func (c *Client) ReserveStock(ctx context.Context, items []StockItem) error {
+	_, err := c.service.ReserveStock(ctx, &pb.ReserveStockRequest{Items: stockItemsOut(items)})
+
+	return err
+}
+
+func (c *Client) ReleaseStock(ctx context.Context, items []StockItem) error {
+	_, err := c.service.ReleaseStock(ctx, &pb.ReleaseStockRequest{Items: stockItemsOut(items)})
+
+	return err
+}
+
+func (c *Client) CommitStock(ctx context.Context, items []StockItem) error {
+	_, err := c.service.CommitStock(ctx, &pb.CommitStockRequest{Items: stockItemsOut(items)})
+
+	return err
+}
+
+func stockItemsOut(items []StockItem) []*pb.StockItem {
+	out := make([]*pb.StockItem, 0, len(items))
+
+	for _, item := range items {
+		out = append(out, &pb.StockItem{ProductId: item.ProductID, Quantity: item.Quantity})
 	}
 
-	return products, nil
+	return out
 }
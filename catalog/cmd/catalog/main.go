@@ -1,19 +1,44 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"os"
 	"time"
 
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	"github.com/azizkhan030/go-grpc-graphql/catalog"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
 )
 
 type Config struct {
-	DatabaseURL string `envconfig:DATABASE_URL`
+	DatabaseURL string `envconfig:"DATABASE_URL"`
+	JWTSecret   string `envconfig:"JWT_SECRET" required:"true"`
+	Index       string `envconfig:"CATALOG_INDEX" default:"catalog"`
+}
+
+// ReindexConfig is the configuration of the reindex subcommand, which
+// doesn't serve requests and so needs no JWT secret. Products indexed before
+// prices had a currency are priced in DefaultCurrency.
+type ReindexConfig struct {
+	DatabaseURL     string `envconfig:"DATABASE_URL"`
+	Index           string `envconfig:"CATALOG_INDEX" default:"catalog"`
+	DefaultCurrency string `envconfig:"DEFAULT_CURRENCY" default:"USD"`
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reindex":
+			reindex()
+			return
+		default:
+			log.Fatalf("unknown command %q, want reindex", os.Args[1])
+		}
+	}
+
 	var cfg Config
 
 	err := envconfig.Process("", &cfg)
@@ -22,9 +47,18 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err = auth.CheckSecret(cfg.JWTSecret); err != nil {
+		log.Fatal(err)
+	}
+
 	var r catalog.Repository
 	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
-		r, err = catalog.NewElasticRepository(cfg.DatabaseURL)
+		r, err = catalog.NewElasticRepository(cfg.DatabaseURL, cfg.Index)
+
+		// Retrying won't fix the mapping
+		if errors.Is(err, catalog.ErrIncompatibleMapping) {
+			log.Fatalf("%v, rebuild the index with the reindex command", err)
+		}
 
 		if err != nil {
 			log.Println(err)
@@ -34,5 +68,31 @@ func main() {
 	defer r.Close()
 	log.Println("Listening on port 8080...")
 	s := catalog.NewService(r)
-	log.Fatal(catalog.ListenGRPC(s, 8080))
+	log.Fatal(catalog.ListenGRPC(s, auth.NewTokenIssuer(cfg.JWTSecret, 0), 8080))
+}
+
+// reindex rebuilds the catalog index with the current mapping while the
+// catalog keeps serving from the old one.
+func reindex() {
+	var cfg ReindexConfig
+
+	err := envconfig.Process("", &cfg)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	old, err := catalog.Reindex(context.Background(), cfg.DatabaseURL, cfg.Index, cfg.DefaultCurrency, func(p catalog.ReindexProgress) {
+		log.Printf("%s: %d/%d documents copied, %d up to date", p.Pass, p.Copied, p.Total, p.Conflicts)
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%s now points to the current mapping", cfg.Index)
+
+	if old != "" {
+		log.Printf("%s is no longer used and can be deleted", old)
+	}
 }
@@ -0,0 +1,57 @@
+package catalog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Cursors wrap the Elasticsearch sort values of the last hit of a page, which
+// are passed back as search_after to fetch the next one.
+func encodeCursor(sort []interface{}) (string, error) {
+	b, err := json.Marshal(sort)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(cursor string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var sort []interface{}
+
+	if err = json.Unmarshal(b, &sort); err != nil || len(sort) == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return sort, nil
+}
+
+// idCursors returns the cursors of products in the listing sorted by
+// newest first, which is sorted by ID alone.
+func idCursors(products []Product) ([]string, error) {
+	cursors := make([]string, 0, len(products))
+
+	for _, p := range products {
+		c, err := encodeCursor([]interface{}{p.ID})
+
+		if err != nil {
+			return nil, err
+		}
+
+		cursors = append(cursors, c)
+	}
+
+	return cursors, nil
+}
@@ -0,0 +1,284 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+var (
+	ErrIncompatibleMapping = errors.New("incompatible catalog index mapping")
+)
+
+// mappingVersion is bumped whenever productMapping changes in a way existing
+// indices can't be updated to, e.g. a field changing its type. New fields
+// are added to the live index instead. Every version gets an index of its
+// own, which the configured index name is an alias of.
+const mappingVersion = 1
+
+// fieldMapping is the part of an Elasticsearch field mapping the catalog
+// relies on. Objects have Properties and no Type, unless they are Dynamic,
+// in which case their fields are mapped as they are indexed.
+type fieldMapping struct {
+	Type        string                  `json:"type,omitempty"`
+	Dynamic     string                  `json:"dynamic,omitempty"`
+	MaxShingle  int                     `json:"max_shingle_size,omitempty"`
+	Analyzer    string                  `json:"analyzer,omitempty"`
+	IgnoreAbove int                     `json:"ignore_above,omitempty"`
+	Fields      map[string]fieldMapping `json:"fields,omitempty"`
+	Properties  map[string]fieldMapping `json:"properties,omitempty"`
+}
+
+type indexMapping struct {
+	Dynamic    string                  `json:"dynamic,omitempty"`
+	Meta       map[string]interface{}  `json:"_meta,omitempty"`
+	Properties map[string]fieldMapping `json:"properties"`
+}
+
+// textAnalyzer folds case and accents, so "creme" matches "Crème".
+const textAnalyzer = "product_text"
+
+var indexSettings = map[string]interface{}{
+	"analysis": map[string]interface{}{
+		"analyzer": map[string]interface{}{
+			textAnalyzer: map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "standard",
+				"filter":    []string{"lowercase", "asciifolding"},
+			},
+		},
+	},
+}
+
+var moneyMapping = fieldMapping{
+	Properties: map[string]fieldMapping{
+		"amount":   {Type: "long"},
+		"currency": {Type: "keyword"},
+	},
+}
+
+// suggestShingles is the longest run of words name.suggest indexes as a
+// single term, which ranks suggestions matching whole phrases first.
+const suggestShingles = 3
+
+// productMapping maps productDocument. Amounts are in minor units, so they
+// are longs rather than floats. Documents with unknown fields are rejected
+// instead of guessing their types, except in price_in, which maps every
+// currency to an amount.
+var productMapping = indexMapping{
+	Dynamic: "strict",
+	Meta:    map[string]interface{}{"version": mappingVersion},
+	Properties: map[string]fieldMapping{
+		"id": {Type: "keyword"},
+		"name": {
+			Type:     "text",
+			Analyzer: textAnalyzer,
+			Fields: map[string]fieldMapping{
+				"keyword":  {Type: "keyword", IgnoreAbove: 256},
+				"suggest":  {Type: "search_as_you_type", Analyzer: textAnalyzer, MaxShingle: suggestShingles},
+				"complete": {Type: "completion", Analyzer: textAnalyzer},
+			},
+		},
+		"description":   {Type: "text", Analyzer: textAnalyzer},
+		"price":         moneyMapping,
+		"prices":        moneyMapping,
+		"price_in":      {Dynamic: "true"},
+		"stock":         {Type: "long"},
+		"reserved":      {Type: "long"},
+		"tax_category":  {Type: "keyword"},
+		"categories":    {Type: "keyword"},
+		"category_tree": {Type: "keyword"},
+	},
+}
+
+func versionedIndex(index string, version int) string {
+	return fmt.Sprintf("%s_v%d", index, version)
+}
+
+// ensureIndex creates the versioned catalog index with productMapping and
+// points the alias at it, unless the alias or an index of the same name
+// exists already. An existing index must have a mapping compatible with
+// productMapping, and gets the fields it's missing added. Documents indexed
+// before are then updated in place in the background, which indexes fields
+// derived from the ones they have, e.g. subfields.
+func (r *elasticRepository) ensureIndex(ctx context.Context) error {
+	res, err := r.client.Indices.GetMapping(
+		r.client.Indices.GetMapping.WithIndex(r.index),
+		r.client.Indices.GetMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return r.createIndex(ctx, versionedIndex(r.index, mappingVersion), r.index)
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("error getting mapping: %s", res.String())
+	}
+
+	var live map[string]struct {
+		Mappings indexMapping `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&live); err != nil {
+		return err
+	}
+
+	if len(live) != 1 {
+		return fmt.Errorf("%w: %s points to %d indices", ErrIncompatibleMapping, r.index, len(live))
+	}
+
+	for name, index := range live {
+		missing, err := compatibleFields("", productMapping.Properties, index.Mappings.Properties)
+
+		if err != nil {
+			return fmt.Errorf("%w: index %s: %v", ErrIncompatibleMapping, name, err)
+		}
+
+		if len(missing) > 0 {
+			if err := r.addFields(ctx); err != nil {
+				return err
+			}
+
+			// Search prices are computed from the exchange rates, not derived
+			if slices.Contains(missing, "price_in") {
+				if err := r.RepriceProducts(ctx, ""); err != nil {
+					return err
+				}
+			}
+
+			return r.refreshDocuments(ctx)
+		}
+	}
+
+	return nil
+}
+
+// addFields puts productMapping on the index behind the alias, which adds
+// the fields it doesn't map yet and leaves the others as they are.
+func (r *elasticRepository) addFields(ctx context.Context) error {
+	b, err := json.Marshal(productMapping)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.client.Indices.PutMapping(
+		[]string{r.index},
+		bytes.NewReader(b),
+		r.client.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("%w: error adding fields: %s", ErrIncompatibleMapping, res.String())
+	}
+
+	return nil
+}
+
+// createIndex creates an index with productMapping, with alias pointing at
+// it if given.
+func (r *elasticRepository) createIndex(ctx context.Context, name, alias string) error {
+	body := map[string]interface{}{
+		"settings": indexSettings,
+		"mappings": productMapping,
+	}
+
+	if alias != "" {
+		body["aliases"] = map[string]interface{}{alias: map[string]interface{}{}}
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.client.Indices.Create(
+		name,
+		r.client.Indices.Create.WithBody(bytes.NewReader(b)),
+		r.client.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error creating index %s: %s", name, res.String())
+	}
+
+	return nil
+}
+
+// refreshDocuments starts reindexing every document of the index behind the
+// alias in place, without waiting for it to complete. Documents written in
+// the meantime are skipped, since they are indexed with the new fields
+// already.
+func (r *elasticRepository) refreshDocuments(ctx context.Context) error {
+	res, err := r.client.UpdateByQuery(
+		[]string{r.index},
+		r.client.UpdateByQuery.WithConflicts("proceed"),
+		r.client.UpdateByQuery.WithWaitForCompletion(false),
+		r.client.UpdateByQuery.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error updating documents: %s", res.String())
+	}
+
+	return nil
+}
+
+// compatibleFields checks that every expected field the live mapping has is
+// mapped with the same type, analyzer and subfields, and returns the ones it
+// doesn't have. The live mapping may have fields of its own.
+func compatibleFields(prefix string, expected, live map[string]fieldMapping) (missing []string, err error) {
+	names := make([]string, 0, len(expected))
+
+	for name := range expected {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		want := expected[name]
+		got, ok := live[name]
+		path := prefix + name
+
+		switch {
+		case !ok:
+			missing = append(missing, path)
+			continue
+		case got.Type != want.Type:
+			return nil, fmt.Errorf("field %s is mapped as %q, want %q", path, got.Type, want.Type)
+		case want.Analyzer != "" && got.Analyzer != want.Analyzer:
+			return nil, fmt.Errorf("field %s is analyzed with %q, want %q", path, got.Analyzer, want.Analyzer)
+		}
+
+		for _, subfields := range [][2]map[string]fieldMapping{{want.Fields, got.Fields}, {want.Properties, got.Properties}} {
+			m, err := compatibleFields(path+".", subfields[0], subfields[1])
+
+			if err != nil {
+				return nil, err
+			}
+
+			missing = append(missing, m...)
+		}
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,118 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+// maxRates bounds the exchange rates products are priced with for
+// searching.
+const maxRates = 1000
+
+// searchPrices returns the amounts a product sells for in every currency it
+// can be bought in, keyed by currency: its base price, its price list and
+// its base price converted with every rate from its currency. They are
+// indexed as price_in, so price filters, sorts and facets compare what
+// shoppers are charged rather than base prices in different currencies.
+func searchPrices(price money.Money, prices []money.Money, rates []money.Rate) (map[string]int64, error) {
+	amounts := map[string]int64{price.Currency: price.Amount}
+
+	for _, p := range prices {
+		amounts[p.Currency] = p.Amount
+	}
+
+	for _, rate := range rates {
+		if _, ok := amounts[rate.To]; ok || rate.From != price.Currency {
+			continue
+		}
+
+		converted, err := price.Convert(rate)
+
+		if err != nil {
+			return nil, err
+		}
+
+		amounts[rate.To] = converted.Amount
+	}
+
+	return amounts, nil
+}
+
+// listRates returns every stored exchange rate.
+func (r *elasticRepository) listRates(ctx context.Context) ([]money.Rate, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"size":  maxRates,
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(ratesIndex),
+		r.client.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// No rate was set yet
+	if res.StatusCode == 404 {
+		return []money.Rate{}, nil
+	}
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error listing exchange rates: %s", res.String())
+	}
+
+	var searchResult struct {
+		Hits struct {
+			Hits []struct {
+				Source money.Rate `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&searchResult); err != nil {
+		return nil, err
+	}
+
+	rates := make([]money.Rate, 0, len(searchResult.Hits.Hits))
+
+	for _, hit := range searchResult.Hits.Hits {
+		rates = append(rates, hit.Source)
+	}
+
+	return rates, nil
+}
+
+// RepriceProducts recomputes the search prices of the products with a base
+// price in currency, or of every product if it's empty, from the stored
+// exchange rates. It runs whenever a rate changes, and once for the products
+// indexed before search prices existed.
+func (r *elasticRepository) RepriceProducts(ctx context.Context, currency string) error {
+	rates, err := r.listRates(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := map[string]interface{}{"match_all": map[string]interface{}{}}
+
+	if currency != "" {
+		query = map[string]interface{}{"term": map[string]interface{}{"price.currency": currency}}
+	}
+
+	return r.updateProducts(ctx, query, []string{"price", "prices"}, func(doc productDocument) (map[string]interface{}, error) {
+		amounts, err := searchPrices(doc.Price, doc.Prices, rates)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{"price_in": amounts}, nil
+	})
+}
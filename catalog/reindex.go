@@ -0,0 +1,393 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+var (
+	ErrIndexUpToDate = errors.New("catalog index already has the current mapping version")
+)
+
+// upgradeScript brings a document of an older index up to productMapping
+// while it's copied. Prices were once indexed as floats in major units
+// without a currency, and are converted to Money in params.currency. Those
+// documents had no id field either, and fields productMapping doesn't know
+// are dropped, since the strict mapping would reject the document.
+const upgradeScript = `
+if (ctx._source.price instanceof Number) {
+	long amount = Math.round(((Number) ctx._source.price).doubleValue() * params.scale);
+	ctx._source.price = ['amount': amount, 'currency': params.currency];
+	if (!ctx._source.containsKey('price_in')) {
+		ctx._source.price_in = [params.currency: amount];
+	}
+}
+if (!ctx._source.containsKey('id')) {
+	ctx._source.id = ctx._id;
+}
+ctx._source.keySet().removeIf(field -> !params.fields.contains(field));
+`
+
+// upgradeParams are the parameters of upgradeScript for prices in currency.
+func upgradeParams(currency string) map[string]interface{} {
+	fields := make([]string, 0, len(productMapping.Properties))
+
+	for name := range productMapping.Properties {
+		fields = append(fields, name)
+	}
+
+	sort.Strings(fields)
+
+	return map[string]interface{}{
+		"currency": currency,
+		"scale":    int64(math.Pow10(money.Exponent(currency))),
+		"fields":   fields,
+	}
+}
+
+// reindexPollInterval is how often a running reindex task is asked for its
+// progress.
+const reindexPollInterval = time.Second
+
+// ReindexProgress reports a pass of a reindex. Conflicts counts documents
+// the target already had in the same or a newer version.
+type ReindexProgress struct {
+	Pass      string
+	Total     int64
+	Copied    int64
+	Conflicts int64
+	Done      bool
+}
+
+// Reindex rebuilds the catalog index behind alias with the current mapping
+// without downtime. Products are copied into a new versioned index while the
+// old one keeps serving, then the alias is swapped to the new index in a
+// single atomic update. Writes made during the copy are caught up with a
+// second pass, which keeps the document versions of the old index so only
+// newer documents are copied. The old index is then blocked for writes and
+// caught up a last time before the swap, so no write is lost in between;
+// writes fail for that short while rather than landing in the old index.
+// The old index is kept read-only for rollback and its name returned, unless
+// the alias was a plain index created before the catalog used aliases, which
+// has to be deleted to free its name. Prices indexed without a currency are
+// taken to be in currency.
+func Reindex(ctx context.Context, url, alias, currency string, progress func(ReindexProgress)) (string, error) {
+	if !money.ValidCurrency(currency) {
+		return "", fmt.Errorf("%w: %q", money.ErrInvalidCurrency, currency)
+	}
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{url}})
+	if err != nil {
+		return "", err
+	}
+
+	r := &elasticRepository{client: client, index: alias}
+
+	source, isAlias, err := r.aliasedIndex(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	target := versionedIndex(alias, mappingVersion)
+
+	// Nothing to copy, a fresh index will do
+	if source == "" {
+		return "", r.createIndex(ctx, target, alias)
+	}
+
+	if source == target {
+		return "", fmt.Errorf("%w: %s", ErrIndexUpToDate, target)
+	}
+
+	// A run that failed before the swap leaves the target behind, which
+	// nothing reads from since the alias still points to the source
+	if err = r.deleteIndex(ctx, target); err != nil {
+		return "", err
+	}
+
+	if err = r.createIndex(ctx, target, ""); err != nil {
+		return "", err
+	}
+
+	params := upgradeParams(currency)
+
+	if err = r.copyIndex(ctx, "copy", source, target, params, progress); err != nil {
+		return "", err
+	}
+
+	if err = r.copyIndex(ctx, "catch-up", source, target, params, progress); err != nil {
+		return "", err
+	}
+
+	if err = r.blockWrites(ctx, source, true); err != nil {
+		return "", err
+	}
+
+	// Writes that reached the old index during the catch-up
+	if err = r.copyIndex(ctx, "final catch-up", source, target, params, progress); err == nil {
+		err = r.swapAlias(ctx, source, target, isAlias)
+	}
+
+	if err != nil {
+		if unblockErr := r.blockWrites(context.WithoutCancel(ctx), source, false); unblockErr != nil {
+			return "", errors.Join(err, unblockErr)
+		}
+
+		return "", err
+	}
+
+	if !isAlias {
+		return "", nil
+	}
+
+	return source, nil
+}
+
+// deleteIndex deletes an index unless it doesn't exist.
+func (r *elasticRepository) deleteIndex(ctx context.Context, index string) error {
+	res, err := r.client.Indices.Delete(
+		[]string{index},
+		r.client.Indices.Delete.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != 404 {
+		return fmt.Errorf("error deleting index %s, delete it by hand: %s", index, res.String())
+	}
+
+	return nil
+}
+
+// blockWrites sets or lifts the write block of an index. Reads aren't
+// affected.
+func (r *elasticRepository) blockWrites(ctx context.Context, index string, blocked bool) error {
+	body, err := json.Marshal(map[string]interface{}{"index.blocks.write": blocked})
+	if err != nil {
+		return err
+	}
+
+	res, err := r.client.Indices.PutSettings(
+		bytes.NewReader(body),
+		r.client.Indices.PutSettings.WithIndex(index),
+		r.client.Indices.PutSettings.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error setting write block of %s: %s", index, res.String())
+	}
+
+	return nil
+}
+
+// aliasedIndex returns the index the alias points to. isAlias is false if
+// the alias is a plain index instead, and the index empty if neither exists.
+func (r *elasticRepository) aliasedIndex(ctx context.Context) (index string, isAlias bool, err error) {
+	res, err := r.client.Indices.GetAlias(
+		r.client.Indices.GetAlias.WithName(r.index),
+		r.client.Indices.GetAlias.WithContext(ctx),
+	)
+	if err != nil {
+		return "", false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		exists, err := r.client.Indices.Exists(
+			[]string{r.index},
+			r.client.Indices.Exists.WithContext(ctx),
+		)
+		if err != nil {
+			return "", false, err
+		}
+		defer exists.Body.Close()
+
+		switch {
+		case exists.StatusCode == 404:
+			return "", false, nil
+		case exists.IsError():
+			return "", false, fmt.Errorf("error checking index: %s", exists.String())
+		}
+
+		return r.index, false, nil
+	}
+
+	if res.IsError() {
+		return "", false, fmt.Errorf("error getting alias: %s", res.String())
+	}
+
+	var indices map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return "", false, err
+	}
+
+	if len(indices) != 1 {
+		return "", false, fmt.Errorf("alias %s points to %d indices", r.index, len(indices))
+	}
+
+	for name := range indices {
+		index = name
+	}
+
+	return index, true, nil
+}
+
+// copyIndex copies the documents of source that target doesn't have in the
+// same or a newer version through upgradeScript, reporting the progress of
+// the running task until it completes.
+func (r *elasticRepository) copyIndex(ctx context.Context, pass, source, target string, params map[string]interface{}, progress func(ReindexProgress)) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"conflicts": "proceed",
+		"source":    map[string]interface{}{"index": source},
+		"dest":      map[string]interface{}{"index": target, "version_type": "external"},
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": upgradeScript,
+			"params": params,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := r.client.Reindex(
+		bytes.NewReader(body),
+		r.client.Reindex.WithWaitForCompletion(false),
+		r.client.Reindex.WithRefresh(true),
+		r.client.Reindex.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error starting reindex: %s", res.String())
+	}
+
+	var started struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&started); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reindexPollInterval):
+		}
+
+		p, err := r.reindexTask(ctx, started.Task)
+		if err != nil {
+			return err
+		}
+
+		p.Pass = pass
+		progress(p)
+
+		if p.Done {
+			return nil
+		}
+	}
+}
+
+func (r *elasticRepository) reindexTask(ctx context.Context, id string) (ReindexProgress, error) {
+	res, err := r.client.Tasks.Get(id, r.client.Tasks.Get.WithContext(ctx))
+	if err != nil {
+		return ReindexProgress{}, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return ReindexProgress{}, fmt.Errorf("error getting reindex task: %s", res.String())
+	}
+
+	var task struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Status struct {
+				Total            int64 `json:"total"`
+				Created          int64 `json:"created"`
+				Updated          int64 `json:"updated"`
+				VersionConflicts int64 `json:"version_conflicts"`
+			} `json:"status"`
+		} `json:"task"`
+		Error    json.RawMessage `json:"error"`
+		Response struct {
+			Failures []json.RawMessage `json:"failures"`
+		} `json:"response"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&task); err != nil {
+		return ReindexProgress{}, err
+	}
+
+	if len(task.Error) > 0 {
+		return ReindexProgress{}, fmt.Errorf("reindex failed: %s", task.Error)
+	}
+
+	if len(task.Response.Failures) > 0 {
+		return ReindexProgress{}, fmt.Errorf("reindex failed for %d documents, first: %s", len(task.Response.Failures), task.Response.Failures[0])
+	}
+
+	status := task.Task.Status
+
+	return ReindexProgress{
+		Total:     status.Total,
+		Copied:    status.Created + status.Updated,
+		Conflicts: status.VersionConflicts,
+		Done:      task.Completed,
+	}, nil
+}
+
+// swapAlias points the alias from source to target in a single update, so
+// every request sees either index but never none. A plain index of the
+// alias's name is deleted in the same update.
+func (r *elasticRepository) swapAlias(ctx context.Context, source, target string, isAlias bool) error {
+	remove := map[string]interface{}{"remove_index": map[string]interface{}{"index": source}}
+
+	if isAlias {
+		remove = map[string]interface{}{"remove": map[string]interface{}{"index": source, "alias": r.index}}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"actions": []interface{}{
+			remove,
+			map[string]interface{}{"add": map[string]interface{}{"index": target, "alias": r.index, "is_write_index": true}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := r.client.Indices.UpdateAliases(
+		bytes.NewReader(body),
+		r.client.Indices.UpdateAliases.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error swapping alias: %s", res.String())
+	}
+
+	return nil
+}
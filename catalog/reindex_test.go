@@ -0,0 +1,155 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestUpgradeParams(t *testing.T) {
+	tests := []struct {
+		currency string
+		scale    int64
+	}{
+		{currency: "JPY", scale: 1},
+		{currency: "EUR", scale: 100},
+		{currency: "KWD", scale: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			params := upgradeParams(tt.currency)
+
+			if params["currency"] != tt.currency || params["scale"] != tt.scale {
+				t.Errorf("upgradeParams(%q) = %v %v, want %v %v", tt.currency, params["currency"], params["scale"], tt.currency, tt.scale)
+			}
+
+			fields := params["fields"].([]string)
+
+			if len(fields) != len(productMapping.Properties) || !slices.Contains(fields, "price") || !slices.IsSorted(fields) {
+				t.Errorf("upgradeParams(%q) fields = %v, want the sorted fields of productMapping", tt.currency, fields)
+			}
+		})
+	}
+}
+
+// TestReindexBaselineIndex upgrades an index shaped like the ones the
+// catalog created before it had a mapping of its own: dynamically mapped
+// documents without an id field and with float prices. A target left behind
+// by a failed run is in the way. It needs an Elasticsearch cluster, e.g.
+//
+//	docker run -d -p 9200:9200 -e discovery.type=single-node -e xpack.security.enabled=false elasticsearch:8.15.0
+//	ELASTICSEARCH_URL=http://localhost:9200 go test ./catalog -run TestReindexBaselineIndex
+func TestReindexBaselineIndex(t *testing.T) {
+	url := os.Getenv("ELASTICSEARCH_URL")
+
+	if url == "" {
+		t.Skip("ELASTICSEARCH_URL is not set")
+	}
+
+	ctx := context.Background()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{url}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alias := fmt.Sprintf("reindex_test_%d", time.Now().UnixNano())
+	target := versionedIndex(alias, mappingVersion)
+
+	t.Cleanup(func() {
+		res, err := client.Indices.Delete([]string{alias, target}, client.Indices.Delete.WithIgnoreUnavailable(true))
+		if err == nil {
+			res.Body.Close()
+		}
+	})
+
+	// es runs a request and fails the test on an error response
+	es := func(method, path, body string) {
+		t.Helper()
+
+		req, err := newRequest(method, path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := client.Perform(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode >= 300 {
+			t.Fatalf("%s %s: %s", method, path, res.Status)
+		}
+	}
+
+	es("PUT", "/"+alias+"/_doc/p1", `{"name": "Mug", "description": "Blue", "price": 19.99}`)
+	es("PUT", "/"+alias+"/_doc/p2", `{"name": "Pen", "description": "Black", "price": 2, "color": "black"}`)
+	es("POST", "/"+alias+"/_refresh", "")
+	es("PUT", "/"+target, "")
+
+	old, err := Reindex(ctx, url, alias, "EUR", func(ReindexProgress) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if old != "" {
+		t.Errorf("Reindex() = %q, want no old index to keep", old)
+	}
+
+	for id, want := range map[string]int64{"p1": 1999, "p2": 200} {
+		res, err := client.Get(alias, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var doc struct {
+			Source productDocument `json:"_source"`
+		}
+		var fields struct {
+			Source map[string]json.RawMessage `json:"_source"`
+		}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			t.Fatal(err)
+		}
+
+		p := doc.Source
+
+		if p.ID != id || p.Price.Amount != want || p.Price.Currency != "EUR" || p.PriceIn["EUR"] != want {
+			t.Errorf("%s was upgraded to %+v, want price %d EUR", id, p, want)
+		}
+
+		if _, ok := fields.Source["color"]; ok {
+			t.Errorf("%s kept a field the mapping doesn't know", id)
+		}
+	}
+}
+
+func newRequest(method, path, body string) (*http.Request, error) {
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
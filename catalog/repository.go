@@ -7,40 +7,91 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/azizkhan030/go-grpc-graphql/money"
 	"github.com/elastic/go-elasticsearch/v8"
 )
 
 var (
-	ErrNotFound = errors.New("entity not found")
+	ErrNotFound          = errors.New("entity not found")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrStockConflict     = errors.New("stock was updated concurrently, try again")
 )
 
 type Repository interface {
 	Close()
-	PutProduct(ctx context.Context, p Product) error
+	PutProduct(ctx context.Context, p Product, categoryTree []string) error
 	GetProductByID(ctx context.Context, id string) (*Product, error)
-	ListProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error)
 	ListProductsWithIDs(ctx context.Context, ids []string) ([]Product, error)
-	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]Product, error)
+	SearchProducts(ctx context.Context, s ProductSearch, priceCurrency string, skip uint64, take uint64, cursor string) (*ProductPage, error)
+	AdjustStock(ctx context.Context, id string, stock, reserved int64) error
+	PutRate(ctx context.Context, rate money.Rate) error
+	GetRate(ctx context.Context, from, to string) (*money.Rate, error)
+	PutCategory(ctx context.Context, c Category) error
+	GetCategory(ctx context.Context, slug string) (*Category, error)
+	ListCategories(ctx context.Context, parents []string) ([]Category, error)
+	ListCategoriesWithSlugs(ctx context.Context, slugs []string) ([]Category, error)
+	DeleteCategory(ctx context.Context, slug string) error
+	CountProductsInCategory(ctx context.Context, slug string) (uint64, error)
+	SuggestProducts(ctx context.Context, prefix string, limit int) ([]Suggestion, error)
+	RepriceProducts(ctx context.Context, currency string) error
+	SetProductCategories(ctx context.Context, id string, categories, tree []string) error
 }
 
+// elasticRepository reads and writes products through index, an alias of
+// the versioned index holding them.
 type elasticRepository struct {
 	client *elasticsearch.Client
+	index  string
 }
 
+// productDocument keeps units held for orders that haven't shipped yet in
+// Reserved, apart from the units still available for sale in Stock.
+// CategoryTree holds the product's categories and their ancestors, PriceIn
+// its searchPrices.
 type productDocument struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	ID           string           `json:"id"`
+	Name         string           `json:"name"`
+	Description  string           `json:"description"`
+	Price        money.Money      `json:"price"`
+	Prices       []money.Money    `json:"prices"`
+	Stock        uint32           `json:"stock"`
+	Reserved     uint32           `json:"reserved"`
+	TaxCategory  string           `json:"tax_category"`
+	Categories   []string         `json:"categories,omitempty"`
+	CategoryTree []string         `json:"category_tree,omitempty"`
+	PriceIn      map[string]int64 `json:"price_in,omitempty"`
 }
 
+// Product is priced in Price, unless Prices has an explicit price in the
+// currency it was requested in. ExchangeRate is set if Price was converted
+// from another currency.
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	Price        money.Money   `json:"price"`
+	Prices       []money.Money `json:"prices"`
+	ExchangeRate string        `json:"exchangeRate,omitempty"`
+	Stock        uint32        `json:"stock"`
+	TaxCategory  string        `json:"taxCategory"`
+	Categories   []string      `json:"categories"`
 }
 
-func NewElasticRepository(url string) (Repository, error) {
+// ProductPage is a single page of a listing. Cursors holds the cursor of
+// each product, in the same order, and TotalCount the number of matches
+// across all pages. Facets count the matches of a search across all pages.
+type ProductPage struct {
+	Products   []Product
+	Cursors    []string
+	NextCursor string
+	TotalCount uint64
+	Facets     []Facet
+}
+
+// NewElasticRepository connects to Elasticsearch and makes sure the catalog
+// index exists with the expected mapping. It fails with
+// ErrIncompatibleMapping if the live mapping can't hold products.
+func NewElasticRepository(url, index string) (Repository, error) {
 	cfg := elasticsearch.Config{
 		Addresses: []string{url},
 	}
@@ -49,18 +100,49 @@ func NewElasticRepository(url string) (Repository, error) {
 		return nil, err
 	}
 
-	return &elasticRepository{client: client}, nil
+	r := &elasticRepository{client: client, index: index}
+
+	if err = r.ensureIndex(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if err = r.ensureCategoriesIndex(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if err = r.backfillCategoryTrees(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
 }
 
 func (r *elasticRepository) Close() {
 	// No specific close functionality required for go-elasticsearch
 }
 
-func (r *elasticRepository) PutProduct(ctx context.Context, p Product) error {
+func (r *elasticRepository) PutProduct(ctx context.Context, p Product, categoryTree []string) error {
+	rates, err := r.listRates(ctx)
+	if err != nil {
+		return err
+	}
+
+	priceIn, err := searchPrices(p.Price, p.Prices, rates)
+	if err != nil {
+		return err
+	}
+
 	doc := productDocument{
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
+		ID:           p.ID,
+		Name:         p.Name,
+		Description:  p.Description,
+		Price:        p.Price,
+		Prices:       p.Prices,
+		Stock:        p.Stock,
+		TaxCategory:  p.TaxCategory,
+		Categories:   p.Categories,
+		CategoryTree: categoryTree,
+		PriceIn:      priceIn,
 	}
 	body, err := json.Marshal(doc)
 	if err != nil {
@@ -68,7 +150,7 @@ func (r *elasticRepository) PutProduct(ctx context.Context, p Product) error {
 	}
 
 	res, err := r.client.Index(
-		"catalog",
+		r.index,
 		bytes.NewReader(body),
 		r.client.Index.WithDocumentID(p.ID),
 		r.client.Index.WithContext(ctx),
@@ -86,8 +168,32 @@ func (r *elasticRepository) PutProduct(ctx context.Context, p Product) error {
 }
 
 func (r *elasticRepository) GetProductByID(ctx context.Context, id string) (*Product, error) {
+	doc, err := r.getDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Product{
+		ID:          id,
+		Name:        doc.Source.Name,
+		Description: doc.Source.Description,
+		Price:       doc.Source.Price,
+		Prices:      doc.Source.Prices,
+		Stock:       doc.Source.Stock,
+		TaxCategory: taxCategory(doc.Source.TaxCategory),
+		Categories:  categories(doc.Source.Categories),
+	}, nil
+}
+
+type versionedDocument struct {
+	Source      productDocument `json:"_source"`
+	SeqNo       int             `json:"_seq_no"`
+	PrimaryTerm int             `json:"_primary_term"`
+}
+
+func (r *elasticRepository) getDocument(ctx context.Context, id string) (*versionedDocument, error) {
 	res, err := r.client.Get(
-		"catalog",
+		r.index,
 		id,
 		r.client.Get.WithContext(ctx),
 	)
@@ -104,30 +210,98 @@ func (r *elasticRepository) GetProductByID(ctx context.Context, id string) (*Pro
 		return nil, fmt.Errorf("error getting document: %s", res.String())
 	}
 
-	var doc struct {
-		Source productDocument `json:"_source"`
-	}
+	var doc versionedDocument
 	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
 		return nil, err
 	}
 
-	return &Product{
-		ID:          id,
-		Name:        doc.Source.Name,
-		Description: doc.Source.Description,
-		Price:       doc.Source.Price,
-	}, nil
+	return &doc, nil
 }
 
-func (r *elasticRepository) ListProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error) {
-	query := map[string]interface{}{
-		"from": skip,
-		"size": take,
-		"query": map[string]interface{}{
-			"match_all": map[string]interface{}{},
-		},
+// maxStockAttempts bounds how often a stock update is retried after losing a
+// race with another update of the same product.
+const maxStockAttempts = 5
+
+// AdjustStock adds the given deltas to the available and reserved stock of a
+// product. The document is only written back if it wasn't changed since it
+// was read (if_seq_no/if_primary_term), so concurrent updates can't
+// overwrite each other. Neither count may drop below zero.
+func (r *elasticRepository) AdjustStock(ctx context.Context, id string, stock, reserved int64) error {
+	for attempt := 0; attempt < maxStockAttempts; attempt++ {
+		doc, err := r.getDocument(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		newStock := int64(doc.Source.Stock) + stock
+		newReserved := int64(doc.Source.Reserved) + reserved
+
+		if newStock < 0 || newReserved < 0 {
+			return ErrInsufficientStock
+		}
+
+		doc.Source.Stock = uint32(newStock)
+		doc.Source.Reserved = uint32(newReserved)
+
+		body, err := json.Marshal(doc.Source)
+		if err != nil {
+			return err
+		}
+
+		res, err := r.client.Index(
+			r.index,
+			bytes.NewReader(body),
+			r.client.Index.WithDocumentID(id),
+			r.client.Index.WithIfSeqNo(doc.SeqNo),
+			r.client.Index.WithIfPrimaryTerm(doc.PrimaryTerm),
+			r.client.Index.WithContext(ctx),
+		)
+		if err != nil {
+			return err
+		}
+
+		if res.StatusCode == 409 {
+			res.Body.Close()
+			continue
+		}
+
+		if res.IsError() {
+			defer res.Body.Close()
+			return fmt.Errorf("error updating stock: %s", res.String())
+		}
+
+		res.Body.Close()
+		return nil
+	}
+
+	return ErrStockConflict
+}
+
+// idSortField orders products by their ksuid, i.e. newest first, and gives
+// every hit a unique sort value for search_after.
+const idSortField = "id"
+
+// searchPage runs a sorted search and returns a page of the matched
+// products with the facets the search asked for. A cursor takes precedence
+// over skip, since Elasticsearch doesn't allow from together with
+// search_after.
+func (r *elasticRepository) searchPage(ctx context.Context, query map[string]interface{}, facetCurrency string, skip uint64, take uint64, cursor string) (*ProductPage, error) {
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		query["search_after"] = after
+	} else {
+		query["from"] = skip
 	}
 
+	// One extra hit tells whether another page follows
+	query["size"] = take + 1
+	query["track_total_hits"] = true
+
 	body, err := json.Marshal(query)
 	if err != nil {
 		return nil, err
@@ -135,7 +309,7 @@ func (r *elasticRepository) ListProducts(ctx context.Context, skip uint64, take
 
 	res, err := r.client.Search(
 		r.client.Search.WithContext(ctx),
-		r.client.Search.WithIndex("catalog"),
+		r.client.Search.WithIndex(r.index),
 		r.client.Search.WithBody(bytes.NewReader(body)),
 	)
 	if err != nil {
@@ -149,31 +323,66 @@ func (r *elasticRepository) ListProducts(ctx context.Context, skip uint64, take
 
 	var searchResult struct {
 		Hits struct {
+			Total struct {
+				Value uint64 `json:"value"`
+			} `json:"total"`
 			Hits []struct {
 				ID     string          `json:"_id"`
 				Source productDocument `json:"_source"`
+				Sort   []interface{}   `json:"sort"`
 			} `json:"hits"`
 		} `json:"hits"`
+		Aggregations map[string]json.RawMessage `json:"aggregations"`
 	}
 	if err := json.NewDecoder(res.Body).Decode(&searchResult); err != nil {
 		return nil, err
 	}
 
-	products := make([]Product, 0, len(searchResult.Hits.Hits))
-	for _, hit := range searchResult.Hits.Hits {
-		products = append(products, Product{
+	page := &ProductPage{TotalCount: searchResult.Hits.Total.Value}
+
+	if searchResult.Aggregations != nil {
+		if page.Facets, err = facetsFrom(searchResult.Aggregations, facetCurrency); err != nil {
+			return nil, err
+		}
+	}
+	hits := searchResult.Hits.Hits
+	more := uint64(len(hits)) > take
+
+	if more {
+		hits = hits[:take]
+	}
+
+	page.Products = make([]Product, 0, len(hits))
+	for _, hit := range hits {
+		c, err := encodeCursor(hit.Sort)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Cursors = append(page.Cursors, c)
+		page.Products = append(page.Products, Product{
 			ID:          hit.ID,
 			Name:        hit.Source.Name,
 			Description: hit.Source.Description,
 			Price:       hit.Source.Price,
+			Prices:      hit.Source.Prices,
+			Stock:       hit.Source.Stock,
+			TaxCategory: taxCategory(hit.Source.TaxCategory),
+			Categories:  categories(hit.Source.Categories),
 		})
 	}
 
-	return products, nil
+	if more {
+		page.NextCursor = page.Cursors[len(page.Cursors)-1]
+	}
+
+	return page, nil
 }
 
 func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]Product, error) {
 	query := map[string]interface{}{
+		// Without an explicit size Elasticsearch only returns the first 10
+		"size": len(ids),
 		"query": map[string]interface{}{
 			"ids": map[string]interface{}{
 				"values": ids,
@@ -187,7 +396,7 @@ func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []strin
 
 	res, err := r.client.Search(
 		r.client.Search.WithContext(ctx),
-		r.client.Search.WithIndex("catalog"),
+		r.client.Search.WithIndex(r.index),
 		r.client.Search.WithBody(bytes.NewReader(body)),
 	)
 	if err != nil {
@@ -219,64 +428,230 @@ func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []strin
 			Name:        hit.Source.Name,
 			Description: hit.Source.Description,
 			Price:       hit.Source.Price,
+			Prices:      hit.Source.Prices,
+			Stock:       hit.Source.Stock,
+			TaxCategory: taxCategory(hit.Source.TaxCategory),
+			Categories:  categories(hit.Source.Categories),
 		})
 	}
 
 	return products, nil
 }
 
-func (r *elasticRepository) SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]Product, error) {
-	// Build the search request body
-	searchRequest := map[string]interface{}{
-		"query": map[string]interface{}{
-			"multi_match": map[string]interface{}{
-				"query":    query,
-				"fields":   []string{"name", "description", "category"}, // Adjust fields as per your mapping
-				"operator": "and",
-			},
-		},
-		"from": skip, // Pagination: starting from
-		"size": take, // Pagination: number of items to fetch
+// SearchProducts returns a page of the products matching s, with prices
+// filtered, sorted and faceted in priceCurrency if it isn't empty.
+func (r *elasticRepository) SearchProducts(ctx context.Context, s ProductSearch, priceCurrency string, skip uint64, take uint64, cursor string) (*ProductPage, error) {
+	page, err := r.searchPage(ctx, searchRequest(s, priceCurrency), priceCurrency, skip, take, cursor)
+
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+
+	return page, nil
+}
+
+// ratesIndex holds the exchange rates, one document per currency pair.
+const ratesIndex = "exchange_rates"
+
+func rateID(from, to string) string {
+	return from + "-" + to
+}
+
+func (r *elasticRepository) PutRate(ctx context.Context, rate money.Rate) error {
+	body, err := json.Marshal(rate)
+	if err != nil {
+		return err
 	}
 
-	// Serialize the request body to JSON
-	body, err := json.Marshal(searchRequest)
+	res, err := r.client.Index(
+		ratesIndex,
+		bytes.NewReader(body),
+		r.client.Index.WithDocumentID(rateID(rate.From, rate.To)),
+		// Products are repriced with the rate right after
+		r.client.Index.WithRefresh("true"),
+		r.client.Index.WithContext(ctx),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to serialize search request: %w", err)
+		return err
 	}
+	defer res.Body.Close()
 
-	// Perform the search request
-	res, err := r.client.Search(
-		r.client.Search.WithContext(ctx),
-		r.client.Search.WithIndex("catalog"),
-		r.client.Search.WithBody(bytes.NewReader(body)),
+	if res.IsError() {
+		return fmt.Errorf("error indexing exchange rate: %s", res.String())
+	}
+
+	return nil
+}
+
+func (r *elasticRepository) GetRate(ctx context.Context, from, to string) (*money.Rate, error) {
+	res, err := r.client.Get(
+		ratesIndex,
+		rateID(from, to),
+		r.client.Get.WithContext(ctx),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("search request failed: %w", err)
+		return nil, err
 	}
 	defer res.Body.Close()
 
-	// Parse the search response
+	if res.StatusCode == 404 {
+		return nil, ErrNotFound
+	}
+
 	if res.IsError() {
-		return nil, fmt.Errorf("search request returned an error: %s", res.String())
+		return nil, fmt.Errorf("error getting exchange rate: %s", res.String())
 	}
 
-	var searchResponse struct {
-		Hits struct {
-			Hits []struct {
-				Source Product `json:"_source"`
+	var doc struct {
+		Source money.Rate `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return &doc.Source, nil
+}
+
+// categories returns an empty list for products indexed without
+// categories.
+func categories(c []string) []string {
+	if c == nil {
+		return []string{}
+	}
+
+	return c
+}
+
+// taxCategory defaults products indexed before tax categories existed to
+// DefaultTaxCategory.
+func taxCategory(category string) string {
+	if category == "" {
+		return DefaultTaxCategory
+	}
+
+	return category
+}
+
+const (
+	// updateBatch is the number of products updated per bulk request.
+	updateBatch = 500
+	// updateRetries bounds how often a partial update is retried after
+	// losing a race with another write of the same product.
+	updateRetries = 3
+)
+
+// updateProducts applies a partial update to every product matching query,
+// in batches. update returns the fields to set from the fields of the
+// document listed in source.
+func (r *elasticRepository) updateProducts(ctx context.Context, query map[string]interface{}, source []string, update func(productDocument) (map[string]interface{}, error)) error {
+	var after []interface{}
+
+	for {
+		request := map[string]interface{}{
+			"size":    updateBatch,
+			"query":   query,
+			"_source": source,
+			"sort":    []interface{}{map[string]interface{}{idSortField: "asc"}},
+		}
+
+		if after != nil {
+			request["search_after"] = after
+		}
+
+		body, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+
+		res, err := r.client.Search(
+			r.client.Search.WithContext(ctx),
+			r.client.Search.WithIndex(r.index),
+			r.client.Search.WithBody(bytes.NewReader(body)),
+		)
+		if err != nil {
+			return err
+		}
+
+		if res.IsError() {
+			defer res.Body.Close()
+			return fmt.Errorf("error searching documents: %s", res.String())
+		}
+
+		var searchResult struct {
+			Hits struct {
+				Hits []struct {
+					ID     string          `json:"_id"`
+					Source productDocument `json:"_source"`
+					Sort   []interface{}   `json:"sort"`
+				} `json:"hits"`
 			} `json:"hits"`
-		} `json:"hits"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&searchResult)
+		res.Body.Close()
+
+		if err != nil {
+			return err
+		}
+
+		hits := searchResult.Hits.Hits
+
+		if len(hits) == 0 {
+			return nil
+		}
+
+		var actions bytes.Buffer
+		enc := json.NewEncoder(&actions)
+
+		for _, hit := range hits {
+			fields, err := update(hit.Source)
+			if err != nil {
+				return err
+			}
+
+			if err := enc.Encode(map[string]interface{}{"update": map[string]interface{}{"_id": hit.ID}}); err != nil {
+				return err
+			}
+
+			if err := enc.Encode(map[string]interface{}{"doc": fields}); err != nil {
+				return err
+			}
+		}
+
+		if err = r.bulk(ctx, &actions); err != nil {
+			return err
+		}
+
+		after = hits[len(hits)-1].Sort
+	}
+}
+
+// bulk runs a bulk request against the index and fails if any of its
+// actions did.
+func (r *elasticRepository) bulk(ctx context.Context, body *bytes.Buffer) error {
+	res, err := r.client.Bulk(
+		body,
+		r.client.Bulk.WithIndex(r.index),
+		r.client.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return err
 	}
-	if err := json.NewDecoder(res.Body).Decode(&searchResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error updating products: %s", res.String())
 	}
 
-	// Extract products from the response
-	var products []Product
-	for _, hit := range searchResponse.Hits.Hits {
-		products = append(products, hit.Source)
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return err
 	}
 
-	return products, nil
+	if result.Errors {
+		return fmt.Errorf("error updating products: some updates failed")
+	}
+
+	return nil
 }
@@ -0,0 +1,382 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+var (
+	ErrInvalidSearch = errors.New("invalid product search")
+)
+
+// maxProductPageSize bounds the number of products in a page, which is also
+// the size of a page if none is requested.
+const maxProductPageSize = 100
+
+type ProductSort string
+
+// Products sorted by price are sorted by their price in the currency of the
+// search, those that can't be bought in it last.
+const (
+	SortRelevance ProductSort = "relevance"
+	SortNewest    ProductSort = "newest"
+	SortPriceAsc  ProductSort = "price_asc"
+	SortPriceDesc ProductSort = "price_desc"
+	SortNameAsc   ProductSort = "name_asc"
+	SortNameDesc  ProductSort = "name_desc"
+)
+
+// ProductFilter narrows a search down. Zero values don't filter: products in
+// any of the Categories or their subcategories, with a price within
+// [MinPrice, MaxPrice] and stock left if InStock match. Price bounds match a
+// product's price in their currency, from its price list or converted from
+// its base price.
+type ProductFilter struct {
+	Categories []string
+	MinPrice   money.Money
+	MaxPrice   money.Money
+	InStock    bool
+}
+
+// ProductSearch matches products by Query, or all of them if it's empty.
+// Without a sort, matches are sorted by relevance to the query, or newest
+// first without one.
+type ProductSearch struct {
+	Query  string
+	Filter ProductFilter
+	Sort   ProductSort
+}
+
+// Facets of a search, each counting the matches per bucket as if the
+// facet's own filter wasn't set, so other buckets can be offered as
+// alternatives.
+const (
+	FacetCategory     = "category"
+	FacetAvailability = "availability"
+	FacetPrice        = "price"
+)
+
+const (
+	BucketInStock    = "in_stock"
+	BucketOutOfStock = "out_of_stock"
+)
+
+// Facet holds the buckets of one facet of a search.
+type Facet struct {
+	Name    string
+	Buckets []FacetBucket
+}
+
+// FacetBucket counts the matches with Key. Price buckets are keyed by their
+// range and also have it in From and To, both inclusive.
+type FacetBucket struct {
+	Key   string
+	Count uint64
+	From  money.Money
+	To    money.Money
+}
+
+const (
+	// maxCategoryBuckets bounds the categories of the category facet, the
+	// ones with the most matches. A product counts towards its categories
+	// and all their ancestors.
+	maxCategoryBuckets = 20
+	// priceBuckets is the number of price ranges the price facet splits the
+	// matches into, each around a cluster of similar prices.
+	priceBuckets = 5
+)
+
+// normalizeCategories lowercases categories and drops blank and duplicate
+// ones.
+func normalizeCategories(categories []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+
+	for _, c := range categories {
+		c = strings.ToLower(strings.TrimSpace(c))
+
+		if c != "" && !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// normalize validates the search and fills in the default sort.
+func (s ProductSearch) normalize() (ProductSearch, error) {
+	s.Query = strings.TrimSpace(s.Query)
+	s.Filter.Categories = normalizeCategories(s.Filter.Categories)
+
+	if s.Sort == "" || (s.Sort == SortRelevance && s.Query == "") {
+		s.Sort = SortNewest
+
+		if s.Query != "" {
+			s.Sort = SortRelevance
+		}
+	}
+
+	switch s.Sort {
+	case SortRelevance, SortNewest, SortPriceAsc, SortPriceDesc, SortNameAsc, SortNameDesc:
+	default:
+		return s, fmt.Errorf("%w: unknown sort %q", ErrInvalidSearch, s.Sort)
+	}
+
+	for _, p := range []money.Money{s.Filter.MinPrice, s.Filter.MaxPrice} {
+		if p.Currency != "" && (p.IsNegative() || !money.ValidCurrency(p.Currency)) {
+			return s, fmt.Errorf("%w: price bounds must be non-negative amounts in a currency", ErrInvalidSearch)
+		}
+	}
+
+	if min, max := s.Filter.MinPrice, s.Filter.MaxPrice; min.Currency != "" && max.Currency != "" {
+		if min.Currency != max.Currency {
+			return s, fmt.Errorf("%w: price bounds must be in the same currency", ErrInvalidSearch)
+		}
+
+		if min.Amount > max.Amount {
+			return s, fmt.Errorf("%w: minPrice exceeds maxPrice", ErrInvalidSearch)
+		}
+	}
+
+	return s, nil
+}
+
+// priceCurrency returns the currency of the price filter, empty if there is
+// none.
+func (f ProductFilter) priceCurrency() string {
+	if f.MinPrice.Currency != "" {
+		return f.MinPrice.Currency
+	}
+
+	return f.MaxPrice.Currency
+}
+
+// searchRequest builds the body of an Elasticsearch search for s. The
+// filters are applied as a post_filter, after the facets were counted, and
+// each facet applies the filters but its own. Prices are compared in
+// currency, by the products' search prices. The price facet covers the
+// products that can be bought in it, and is left out without one.
+func searchRequest(s ProductSearch, currency string) map[string]interface{} {
+	query := map[string]interface{}{"match_all": map[string]interface{}{}}
+
+	if s.Query != "" {
+		query = map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":    s.Query,
+				"fields":   []string{"name^2", "description"},
+				"operator": "and",
+			},
+		}
+	}
+
+	filters := map[string][]interface{}{}
+
+	if len(s.Filter.Categories) > 0 {
+		filters[FacetCategory] = []interface{}{
+			map[string]interface{}{"terms": map[string]interface{}{"category_tree": s.Filter.Categories}},
+		}
+	}
+
+	if s.Filter.InStock {
+		filters[FacetAvailability] = []interface{}{inStockQuery}
+	}
+
+	if s.Filter.priceCurrency() != "" {
+		amount := map[string]interface{}{}
+
+		if s.Filter.MinPrice.Currency != "" {
+			amount["gte"] = s.Filter.MinPrice.Amount
+		}
+
+		if s.Filter.MaxPrice.Currency != "" {
+			amount["lte"] = s.Filter.MaxPrice.Amount
+		}
+
+		filters[FacetPrice] = []interface{}{
+			map[string]interface{}{"range": map[string]interface{}{priceField(currency): amount}},
+		}
+	}
+
+	// except returns the filters of every facet but the given one, plus the
+	// extra clauses
+	except := func(facet string, extra ...interface{}) map[string]interface{} {
+		clauses := append([]interface{}{}, extra...)
+
+		for name, f := range filters {
+			if name != facet {
+				clauses = append(clauses, f...)
+			}
+		}
+
+		return map[string]interface{}{"bool": map[string]interface{}{"filter": clauses}}
+	}
+
+	aggs := map[string]interface{}{
+		FacetCategory: map[string]interface{}{
+			"filter": except(FacetCategory),
+			"aggs": map[string]interface{}{
+				"buckets": map[string]interface{}{
+					"terms": map[string]interface{}{"field": "category_tree", "size": maxCategoryBuckets},
+				},
+			},
+		},
+		FacetAvailability: map[string]interface{}{
+			"filter": except(FacetAvailability),
+			"aggs": map[string]interface{}{
+				"buckets": map[string]interface{}{
+					"filters": map[string]interface{}{
+						"filters": map[string]interface{}{
+							BucketInStock:    inStockQuery,
+							BucketOutOfStock: map[string]interface{}{"bool": map[string]interface{}{"must_not": inStockQuery}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if currency != "" {
+		aggs[FacetPrice] = map[string]interface{}{
+			"filter": except(FacetPrice, map[string]interface{}{"exists": map[string]interface{}{"field": priceField(currency)}}),
+			"aggs": map[string]interface{}{
+				"buckets": map[string]interface{}{
+					"variable_width_histogram": map[string]interface{}{"field": priceField(currency), "buckets": priceBuckets},
+				},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"query":       query,
+		"post_filter": except(""),
+		"aggs":        aggs,
+		"sort":        sortClauses(s.Sort, currency),
+	}
+}
+
+// priceField is the field holding the products' search prices in currency.
+func priceField(currency string) string {
+	return "price_in." + currency
+}
+
+var inStockQuery = map[string]interface{}{
+	"range": map[string]interface{}{"stock": map[string]interface{}{"gt": 0}},
+}
+
+// sortClauses returns the Elasticsearch sort of a product sort, comparing
+// prices in currency. Ties are broken by ID, so every hit has a unique sort
+// value for search_after.
+func sortClauses(sort ProductSort, currency string) []interface{} {
+	by := func(field, order string) interface{} {
+		return map[string]interface{}{field: map[string]interface{}{"order": order}}
+	}
+
+	// Products without a price in the currency, and indices without a
+	// product priced in it yet, sort last
+	byPrice := func(order string) interface{} {
+		return map[string]interface{}{priceField(currency): map[string]interface{}{
+			"order":         order,
+			"missing":       "_last",
+			"unmapped_type": "long",
+		}}
+	}
+
+	switch sort {
+	case SortRelevance:
+		return []interface{}{by("_score", "desc"), by(idSortField, "asc")}
+	case SortPriceAsc:
+		return []interface{}{byPrice("asc"), by(idSortField, "asc")}
+	case SortPriceDesc:
+		return []interface{}{byPrice("desc"), by(idSortField, "desc")}
+	case SortNameAsc:
+		return []interface{}{by("name.keyword", "asc"), by(idSortField, "asc")}
+	case SortNameDesc:
+		return []interface{}{by("name.keyword", "desc"), by(idSortField, "desc")}
+	}
+
+	return []interface{}{by(idSortField, "desc")}
+}
+
+// facetsFrom reads the facets out of the aggregations of a search response.
+// Facets are returned in a fixed order, the price facet last if it was
+// requested.
+func facetsFrom(aggregations map[string]json.RawMessage, currency string) ([]Facet, error) {
+	var facets []Facet
+
+	var category struct {
+		Buckets struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount uint64 `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"buckets"`
+	}
+	if err := json.Unmarshal(aggregations[FacetCategory], &category); err != nil {
+		return nil, err
+	}
+
+	f := Facet{Name: FacetCategory, Buckets: []FacetBucket{}}
+
+	for _, b := range category.Buckets.Buckets {
+		f.Buckets = append(f.Buckets, FacetBucket{Key: b.Key, Count: b.DocCount})
+	}
+
+	facets = append(facets, f)
+
+	var availability struct {
+		Buckets struct {
+			Buckets map[string]struct {
+				DocCount uint64 `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"buckets"`
+	}
+	if err := json.Unmarshal(aggregations[FacetAvailability], &availability); err != nil {
+		return nil, err
+	}
+
+	f = Facet{Name: FacetAvailability, Buckets: []FacetBucket{}}
+
+	for _, key := range []string{BucketInStock, BucketOutOfStock} {
+		f.Buckets = append(f.Buckets, FacetBucket{Key: key, Count: availability.Buckets.Buckets[key].DocCount})
+	}
+
+	facets = append(facets, f)
+
+	if currency == "" {
+		return facets, nil
+	}
+
+	var price struct {
+		Buckets struct {
+			Buckets []struct {
+				Min      float64 `json:"min"`
+				Max      float64 `json:"max"`
+				DocCount uint64  `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"buckets"`
+	}
+	if err := json.Unmarshal(aggregations[FacetPrice], &price); err != nil {
+		return nil, err
+	}
+
+	f = Facet{Name: FacetPrice, Buckets: []FacetBucket{}}
+
+	for _, b := range price.Buckets.Buckets {
+		from := money.Money{Amount: int64(b.Min), Currency: currency}
+		to := money.Money{Amount: int64(b.Max), Currency: currency}
+
+		f.Buckets = append(f.Buckets, FacetBucket{
+			Key:   from.String() + "-" + to.String(),
+			Count: b.DocCount,
+			From:  from,
+			To:    to,
+		})
+	}
+
+	return append(facets, f), nil
+}
@@ -2,13 +2,18 @@ package catalog
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	pb "github.com/azizkhan030/go-grpc-graphql/catalog/protos/gen"
+	"github.com/azizkhan030/go-grpc-graphql/money"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
@@ -16,14 +21,34 @@ type grpcServer struct {
 	service Service
 }
 
-func ListenGRPC(s Service, port int) error {
+var policy = auth.Policy{
+	pb.CatalogService_PostProduct_FullMethodName:     auth.RoleAdmin,
+	pb.CatalogService_GetProduct_FullMethodName:      auth.Public,
+	pb.CatalogService_GetProducts_FullMethodName:     auth.Public,
+	pb.CatalogService_SuggestProducts_FullMethodName: auth.Public,
+	// Only called by the order service, for the orders it places and settles
+	pb.CatalogService_ReserveStock_FullMethodName: auth.RoleService,
+	pb.CatalogService_ReleaseStock_FullMethodName: auth.RoleService,
+	pb.CatalogService_CommitStock_FullMethodName:  auth.RoleService,
+
+	pb.CatalogService_SetExchangeRate_FullMethodName: auth.RoleAdmin,
+
+	pb.CatalogService_PostCategory_FullMethodName:   auth.RoleAdmin,
+	pb.CatalogService_GetCategory_FullMethodName:    auth.Public,
+	pb.CatalogService_GetCategories_FullMethodName:  auth.Public,
+	pb.CatalogService_DeleteCategory_FullMethodName: auth.RoleAdmin,
+
+	pb.CatalogService_SetProductCategories_FullMethodName: auth.RoleAdmin,
+}
+
+func ListenGRPC(s Service, tokens *auth.TokenIssuer, port int) error {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 
 	if err != nil {
 		return err
 	}
 
-	serv := grpc.NewServer()
+	serv := grpc.NewServer(grpc.UnaryInterceptor(auth.UnaryServerInterceptor(tokens, policy)))
 
 	pb.RegisterCatalogServiceServer(serv, &grpcServer{
 		pb.UnimplementedCatalogServiceServer{},
@@ -36,7 +61,17 @@ func ListenGRPC(s Service, port int) error {
 }
 
 func (s *grpcServer) PostProduct(ctx context.Context, r *pb.PostProductRequest) (*pb.PostProductResponse, error) {
-	p, err := s.service.PostProduct(ctx, r.Name, r.Description, r.Price)
+	prices := []money.Money{}
+
+	for _, price := range r.Prices {
+		prices = append(prices, money.FromProto(price))
+	}
+
+	p, err := s.service.PostProduct(ctx, r.Name, r.Description, r.TaxCategory, r.Categories, money.FromProto(r.Price), prices, r.Stock)
+
+	if errors.Is(err, ErrInvalidPrice) || errors.Is(err, ErrUnknownCategory) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	if err != nil {
 		log.Println(err)
@@ -49,11 +84,10 @@ func (s *grpcServer) PostProduct(ctx context.Context, r *pb.PostProductRequest)
 }
 
 func (s *grpcServer) GetProduct(ctx context.Context, r *pb.GetProductRequest) (*pb.GetProductResponse, error) {
-	p, err := s.service.GetProduct(ctx, r.Id)
+	p, err := s.service.GetProduct(ctx, r.Id, r.Currency)
 
 	if err != nil {
-		log.Println(err)
-		return nil, err
+		return nil, priceError(err)
 	}
 
 	return &pb.GetProductResponse{
@@ -62,27 +96,224 @@ func (s *grpcServer) GetProduct(ctx context.Context, r *pb.GetProductRequest) (*
 }
 
 func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest) (*pb.GetProductsResponse, error) {
-	var res []Product
+	var page *ProductPage
 	var err error
 
-	if r.Query != "" {
-		res, err = s.service.SearchProducts(ctx, r.Query, r.Skip, r.Take)
-	} else if len(r.Ids) != 0 {
-		res, err = s.service.GetProductsByIDs(ctx, r.Ids)
+	if r.Query == "" && len(r.Ids) != 0 {
+		var res []Product
+
+		if res, err = s.service.GetProductsByIDs(ctx, r.Ids, r.Currency); err == nil {
+			page = &ProductPage{Products: res, TotalCount: uint64(len(res))}
+			page.Cursors, err = idCursors(res)
+		}
 	} else {
-		res, err = s.service.GetProducts(ctx, r.Skip, r.Take)
+		page, err = s.service.SearchProducts(ctx, searchIn(r), r.Skip, r.Take, r.Cursor, r.Currency)
+	}
+
+	if errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrInvalidSearch) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	if err != nil {
+		return nil, priceError(err)
+	}
+
+	return &pb.GetProductsResponse{
+		Products:   mapProductsToProductsResponse(page.Products),
+		NextCursor: page.NextCursor,
+		TotalCount: page.TotalCount,
+		Cursors:    page.Cursors,
+		Facets:     facetsOut(page.Facets),
+	}, nil
+}
+
+func (s *grpcServer) SuggestProducts(ctx context.Context, r *pb.SuggestProductsRequest) (*pb.SuggestProductsResponse, error) {
+	suggestions, err := s.service.SuggestProducts(ctx, r.Prefix, int(r.Limit))
+
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	return &pb.GetProductsResponse{
-		Products: mapProductsToProductsResponse(res),
+	out := []*pb.ProductSuggestion{}
+
+	for _, s := range suggestions {
+		out = append(out, &pb.ProductSuggestion{Text: s.Text, ProductId: s.ProductID})
+	}
+
+	return &pb.SuggestProductsResponse{Suggestions: out}, nil
+}
+
+func (s *grpcServer) ReserveStock(ctx context.Context, r *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	if err := s.service.ReserveStock(ctx, stockItemsIn(r.Items)); err != nil {
+		return nil, stockError(err)
+	}
+
+	return &pb.ReserveStockResponse{}, nil
+}
+
+func (s *grpcServer) ReleaseStock(ctx context.Context, r *pb.ReleaseStockRequest) (*pb.ReleaseStockResponse, error) {
+	if err := s.service.ReleaseStock(ctx, stockItemsIn(r.Items)); err != nil {
+		return nil, stockError(err)
+	}
+
+	return &pb.ReleaseStockResponse{}, nil
+}
+
+func (s *grpcServer) CommitStock(ctx context.Context, r *pb.CommitStockRequest) (*pb.CommitStockResponse, error) {
+	if err := s.service.CommitStock(ctx, stockItemsIn(r.Items)); err != nil {
+		return nil, stockError(err)
+	}
+
+	return &pb.CommitStockResponse{}, nil
+}
+
+func (s *grpcServer) SetExchangeRate(ctx context.Context, r *pb.SetExchangeRateRequest) (*pb.SetExchangeRateResponse, error) {
+	if r.Rate == nil {
+		return nil, status.Error(codes.InvalidArgument, money.ErrInvalidRate.Error())
+	}
+
+	rate, err := s.service.SetExchangeRate(ctx, r.Rate.From, r.Rate.To, r.Rate.Rate)
+
+	if errors.Is(err, money.ErrInvalidRate) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &pb.SetExchangeRateResponse{
+		Rate: &pb.ExchangeRate{From: rate.From, To: rate.To, Rate: rate.Value},
 	}, nil
 }
 
+func (s *grpcServer) PostCategory(ctx context.Context, r *pb.PostCategoryRequest) (*pb.PostCategoryResponse, error) {
+	c, err := s.service.PostCategory(ctx, r.Name, r.Slug, r.Parent)
+
+	if err != nil {
+		return nil, categoryError(err)
+	}
+
+	return &pb.PostCategoryResponse{Category: categoryOut(c)}, nil
+}
+
+func (s *grpcServer) GetCategory(ctx context.Context, r *pb.GetCategoryRequest) (*pb.GetCategoryResponse, error) {
+	c, err := s.service.GetCategory(ctx, r.Slug)
+
+	if err != nil {
+		return nil, categoryError(err)
+	}
+
+	return &pb.GetCategoryResponse{Category: categoryOut(c)}, nil
+}
+
+func (s *grpcServer) GetCategories(ctx context.Context, r *pb.GetCategoriesRequest) (*pb.GetCategoriesResponse, error) {
+	var categories []Category
+	var err error
+
+	switch {
+	case len(r.Slugs) > 0:
+		categories, err = s.service.GetCategoriesWithSlugs(ctx, r.Slugs)
+	case len(r.Parents) > 0:
+		categories, err = s.service.GetSubcategories(ctx, r.Parents)
+	default:
+		categories, err = s.service.GetCategories(ctx, r.Parent)
+	}
+
+	if err != nil {
+		return nil, categoryError(err)
+	}
+
+	out := []*pb.Category{}
+
+	for i := range categories {
+		out = append(out, categoryOut(&categories[i]))
+	}
+
+	return &pb.GetCategoriesResponse{Categories: out}, nil
+}
+
+func (s *grpcServer) DeleteCategory(ctx context.Context, r *pb.DeleteCategoryRequest) (*pb.DeleteCategoryResponse, error) {
+	if err := s.service.DeleteCategory(ctx, r.Slug); err != nil {
+		return nil, categoryError(err)
+	}
+
+	return &pb.DeleteCategoryResponse{}, nil
+}
+
+func (s *grpcServer) SetProductCategories(ctx context.Context, r *pb.SetProductCategoriesRequest) (*pb.SetProductCategoriesResponse, error) {
+	p, err := s.service.SetProductCategories(ctx, r.Id, r.Categories)
+
+	if err != nil {
+		return nil, categoryError(err)
+	}
+
+	return &pb.SetProductCategoriesResponse{
+		Product: productOut(p),
+	}, nil
+}
+
+func categoryOut(c *Category) *pb.Category {
+	return &pb.Category{Slug: c.Slug, Name: c.Name, Parent: c.Parent, Path: c.Path}
+}
+
+func categoryError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidCategory), errors.Is(err, ErrUnknownCategory):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrCategoryExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrCategoryInUse):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	log.Println(err)
+	return err
+}
+
+// priceError maps the errors of pricing products in a requested currency.
+func priceError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, money.ErrInvalidCurrency):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNoExchangeRate):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	log.Println(err)
+	return err
+}
+
+func stockError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInsufficientStock):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrStockConflict):
+		return status.Error(codes.Aborted, err.Error())
+	}
+
+	log.Println(err)
+	return err
+}
+
+func stockItemsIn(items []*pb.StockItem) []StockItem {
+	out := make([]StockItem, 0, len(items))
+
+	for _, item := range items {
+		out = append(out, StockItem{ProductID: item.ProductId, Quantity: item.Quantity})
+	}
+
+	return out
+}
+
 func mapProductsToProductsResponse(p []Product) []*pb.Product {
 	products := []*pb.Product{}
 
@@ -94,10 +325,57 @@ func mapProductsToProductsResponse(p []Product) []*pb.Product {
 }
 
 func productOut(p *Product) *pb.Product {
-	return &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Price:       p.Price,
-		Description: p.Description,
+	out := &pb.Product{
+		Id:           p.ID,
+		Name:         p.Name,
+		Price:        p.Price.Proto(),
+		Description:  p.Description,
+		Stock:        p.Stock,
+		ExchangeRate: p.ExchangeRate,
+		TaxCategory:  p.TaxCategory,
+		Categories:   p.Categories,
+	}
+
+	for _, price := range p.Prices {
+		out.Prices = append(out.Prices, price.Proto())
 	}
+
+	return out
+}
+
+func searchIn(r *pb.GetProductsRequest) ProductSearch {
+	s := ProductSearch{Query: r.Query, Sort: ProductSort(r.Sort)}
+
+	if f := r.Filter; f != nil {
+		s.Filter = ProductFilter{
+			Categories: f.Categories,
+			MinPrice:   money.FromProto(f.MinPrice),
+			MaxPrice:   money.FromProto(f.MaxPrice),
+			InStock:    f.InStock,
+		}
+	}
+
+	return s
+}
+
+func facetsOut(facets []Facet) []*pb.Facet {
+	out := []*pb.Facet{}
+
+	for _, f := range facets {
+		facet := &pb.Facet{Name: f.Name}
+
+		for _, b := range f.Buckets {
+			bucket := &pb.Facet_Bucket{Key: b.Key, Count: b.Count}
+
+			if b.From.Currency != "" {
+				bucket.From, bucket.To = b.From.Proto(), b.To.Proto()
+			}
+
+			facet.Buckets = append(facet.Buckets, bucket)
+		}
+
+		out = append(out, facet)
+	}
+
+	return out
 }
@@ -2,16 +2,41 @@ package catalog
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/azizkhan030/go-grpc-graphql/money"
 	"github.com/segmentio/ksuid"
 )
 
 type Service interface {
-	PostProduct(ctx context.Context, name, description string, price float64) (*Product, error)
-	GetProduct(ctx context.Context, id string) (*Product, error)
-	GetProducts(ctx context.Context, skip, take uint64) ([]Product, error)
-	GetProductsByIDs(ctx context.Context, ids []string) ([]Product, error)
-	SearchProducts(ctx context.Context, query string, skip, take uint64) ([]Product, error)
+	PostProduct(ctx context.Context, name, description, taxCategory string, categories []string, price money.Money, prices []money.Money, stock uint32) (*Product, error)
+	GetProduct(ctx context.Context, id, currency string) (*Product, error)
+	GetProductsByIDs(ctx context.Context, ids []string, currency string) ([]Product, error)
+	SearchProducts(ctx context.Context, search ProductSearch, skip, take uint64, cursor, currency string) (*ProductPage, error)
+	SuggestProducts(ctx context.Context, prefix string, limit int) ([]Suggestion, error)
+	ReserveStock(ctx context.Context, items []StockItem) error
+	ReleaseStock(ctx context.Context, items []StockItem) error
+	CommitStock(ctx context.Context, items []StockItem) error
+	SetExchangeRate(ctx context.Context, from, to, rate string) (*money.Rate, error)
+	PostCategory(ctx context.Context, name, slug, parent string) (*Category, error)
+	GetCategory(ctx context.Context, slug string) (*Category, error)
+	GetCategories(ctx context.Context, parent string) ([]Category, error)
+	GetSubcategories(ctx context.Context, parents []string) ([]Category, error)
+	GetCategoriesWithSlugs(ctx context.Context, slugs []string) ([]Category, error)
+	DeleteCategory(ctx context.Context, slug string) error
+	SetProductCategories(ctx context.Context, id string, categories []string) (*Product, error)
+}
+
+var (
+	ErrInvalidPrice   = errors.New("price must be a non-negative amount in a currency")
+	ErrNoExchangeRate = errors.New("no exchange rate")
+)
+
+type StockItem struct {
+	ProductID string
+	Quantity  uint32
 }
 
 type catalogService struct {
@@ -22,54 +47,404 @@ func NewService(r Repository) Service {
 	return &catalogService{r}
 }
 
-func (s *catalogService) PostProduct(ctx context.Context, name, description string, price float64) (*Product, error) {
+// DefaultTaxCategory is the tax category of products created without one.
+const DefaultTaxCategory = "standard"
+
+func (s *catalogService) PostProduct(ctx context.Context, name, description, taxCategory string, categories []string, price money.Money, prices []money.Money, stock uint32) (*Product, error) {
+	currencies := map[string]bool{}
+
+	for _, p := range append([]money.Money{price}, prices...) {
+		if p.IsNegative() || !money.ValidCurrency(p.Currency) || currencies[p.Currency] {
+			return nil, ErrInvalidPrice
+		}
+
+		currencies[p.Currency] = true
+	}
+
 	p := &Product{
 		Name:        name,
 		Description: description,
 		Price:       price,
+		Prices:      prices,
+		Stock:       stock,
+		TaxCategory: strings.ToLower(strings.TrimSpace(taxCategory)),
+		Categories:  normalizeCategories(categories),
 		ID:          ksuid.New().String(),
 	}
 
-	if err := s.repository.PutProduct(ctx, *p); err != nil {
+	if p.TaxCategory == "" {
+		p.TaxCategory = DefaultTaxCategory
+	}
+
+	assigned, err := s.lookUpCategories(ctx, p.Categories)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.PutProduct(ctx, *p, categoryTree(assigned)); err != nil {
 		return nil, err
 	}
 
 	return p, nil
 }
 
-func (s *catalogService) GetProduct(ctx context.Context, id string) (*Product, error) {
+// lookUpCategories returns the categories with the given slugs, failing with
+// ErrUnknownCategory if one of them doesn't exist.
+func (s *catalogService) lookUpCategories(ctx context.Context, slugs []string) ([]Category, error) {
+	categories := []Category{}
+
+	for _, slug := range slugs {
+		c, err := s.repository.GetCategory(ctx, slug)
+
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCategory, slug)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		categories = append(categories, *c)
+	}
+
+	return categories, nil
+}
+
+func (s *catalogService) GetProduct(ctx context.Context, id, currency string) (*Product, error) {
 	p, err := s.repository.GetProductByID(ctx, id)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return p, nil
-}
+	products := []Product{*p}
 
-func (s *catalogService) GetProducts(ctx context.Context, skip, take uint64) ([]Product, error) {
-	if take > 100 || (skip == 0 && take == 0) {
-		take = 100
+	if err = s.priceIn(ctx, products, currency); err != nil {
+		return nil, err
 	}
 
-	return s.repository.ListProducts(ctx, skip, take)
+	return &products[0], nil
 }
 
-func (s *catalogService) GetProductsByIDs(ctx context.Context, ids []string) ([]Product, error) {
+func (s *catalogService) GetProductsByIDs(ctx context.Context, ids []string, currency string) ([]Product, error) {
 	p, err := s.repository.ListProductsWithIDs(ctx, ids)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if err = s.priceIn(ctx, p, currency); err != nil {
+		return nil, err
+	}
+
 	return p, nil
 
 }
 
-func (s *catalogService) SearchProducts(ctx context.Context, query string, skip, take uint64) ([]Product, error) {
-	if take > 100 || (skip == 0 && take == 0) {
-		take = 100
+// SearchProducts returns a page of the products matching the search, priced
+// in currency. Prices are sorted and faceted in the currency of the price
+// filter, or else in currency, so sorting by price needs one of them. The
+// price facet only counts the products that can be bought in it.
+func (s *catalogService) SearchProducts(ctx context.Context, search ProductSearch, skip, take uint64, cursor, currency string) (*ProductPage, error) {
+	if take > maxProductPageSize || (skip == 0 && take == 0) {
+		take = maxProductPageSize
+	}
+
+	if currency != "" && !money.ValidCurrency(currency) {
+		return nil, money.ErrInvalidCurrency
+	}
+
+	search, err := search.normalize()
+
+	if err != nil {
+		return nil, err
+	}
+
+	priceCurrency := search.Filter.priceCurrency()
+
+	if priceCurrency == "" {
+		priceCurrency = currency
+	}
+
+	if priceCurrency == "" && (search.Sort == SortPriceAsc || search.Sort == SortPriceDesc) {
+		return nil, fmt.Errorf("%w: sorting by price requires a currency", ErrInvalidSearch)
+	}
+
+	page, err := s.repository.SearchProducts(ctx, search, priceCurrency, skip, take, cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.priceIn(ctx, page.Products, currency); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// SuggestProducts returns the names of the products completing prefix, at
+// most limit of them, or defaultSuggestions if limit isn't positive.
+func (s *catalogService) SuggestProducts(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	if limit <= 0 {
+		limit = defaultSuggestions
+	}
+
+	if limit > maxSuggestions {
+		limit = maxSuggestions
+	}
+
+	if p := []rune(prefix); len(p) > maxPrefixLength {
+		prefix = string(p[:maxPrefixLength])
+	}
+
+	prefix = strings.TrimSpace(prefix)
+
+	if prefix == "" {
+		return []Suggestion{}, nil
+	}
+
+	return s.repository.SuggestProducts(ctx, prefix, limit)
+}
+
+// priceIn sets the price of every product to its price in the currency. A
+// price from the product's price list wins over converting the base price
+// with the stored exchange rate. An empty currency keeps the base prices.
+func (s *catalogService) priceIn(ctx context.Context, products []Product, currency string) error {
+	if currency == "" {
+		return nil
+	}
+
+	if !money.ValidCurrency(currency) {
+		return money.ErrInvalidCurrency
+	}
+
+	rates := map[string]*money.Rate{}
+
+	for i := range products {
+		p := &products[i]
+
+		if price, ok := p.listPrice(currency); ok {
+			p.Price = price
+			continue
+		}
+
+		if p.Price.Currency == currency {
+			continue
+		}
+
+		rate, ok := rates[p.Price.Currency]
+
+		if !ok {
+			var err error
+			rate, err = s.repository.GetRate(ctx, p.Price.Currency, currency)
+
+			if errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("%w from %s to %s", ErrNoExchangeRate, p.Price.Currency, currency)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			rates[p.Price.Currency] = rate
+		}
+
+		price, err := p.Price.Convert(*rate)
+
+		if err != nil {
+			return err
+		}
+
+		p.Price = price
+		p.ExchangeRate = rate.Value
+	}
+
+	return nil
+}
+
+func (p Product) listPrice(currency string) (money.Money, bool) {
+	for _, price := range p.Prices {
+		if price.Currency == currency {
+			return price, true
+		}
+	}
+
+	return money.Money{}, false
+}
+
+func (s *catalogService) SetExchangeRate(ctx context.Context, from, to, value string) (*money.Rate, error) {
+	rate, err := money.ParseRate(from, to, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.repository.PutRate(ctx, rate); err != nil {
+		return nil, err
+	}
+
+	// Setting the rate again retries repricing if it fails
+	if err = s.repository.RepriceProducts(ctx, rate.From); err != nil {
+		return nil, err
+	}
+
+	return &rate, nil
+}
+
+// ReserveStock moves the items from available to reserved stock. Either all
+// items are reserved or, if one of them can't be, none are.
+func (s *catalogService) ReserveStock(ctx context.Context, items []StockItem) error {
+	for i, item := range items {
+		q := int64(item.Quantity)
+
+		if err := s.repository.AdjustStock(ctx, item.ProductID, -q, q); err != nil {
+			if releaseErr := s.ReleaseStock(ctx, items[:i]); releaseErr != nil {
+				return errors.Join(err, releaseErr)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReleaseStock returns reserved items to the available stock, e.g. when an
+// order couldn't be placed or was cancelled.
+func (s *catalogService) ReleaseStock(ctx context.Context, items []StockItem) error {
+	var errs []error
+
+	for _, item := range items {
+		q := int64(item.Quantity)
+
+		if err := s.repository.AdjustStock(ctx, item.ProductID, q, -q); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CommitStock removes reserved items for good, once their order has shipped.
+func (s *catalogService) CommitStock(ctx context.Context, items []StockItem) error {
+	var errs []error
+
+	for _, item := range items {
+		if err := s.repository.AdjustStock(ctx, item.ProductID, 0, -int64(item.Quantity)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PostCategory adds a category below parent, or at the top of the tree if
+// parent is empty. Slugs are unique across the tree.
+func (s *catalogService) PostCategory(ctx context.Context, name, slug, parent string) (*Category, error) {
+	c := &Category{
+		Slug:   strings.ToLower(strings.TrimSpace(slug)),
+		Name:   strings.TrimSpace(name),
+		Parent: strings.ToLower(strings.TrimSpace(parent)),
+	}
+
+	if c.Name == "" || !slugPattern.MatchString(c.Slug) {
+		return nil, fmt.Errorf("%w: a category needs a name and a slug of lowercase letters, digits and dashes", ErrInvalidCategory)
+	}
+
+	c.Path = c.Slug
+
+	if c.Parent != "" {
+		p, err := s.repository.GetCategory(ctx, c.Parent)
+
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCategory, c.Parent)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(p.Ancestors()) >= maxCategoryDepth {
+			return nil, fmt.Errorf("%w: categories can't be nested more than %d levels deep", ErrInvalidCategory, maxCategoryDepth)
+		}
+
+		c.Path = p.Path + "/" + c.Slug
+	}
+
+	if err := s.repository.PutCategory(ctx, *c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (s *catalogService) GetCategory(ctx context.Context, slug string) (*Category, error) {
+	return s.repository.GetCategory(ctx, strings.ToLower(strings.TrimSpace(slug)))
+}
+
+// GetCategories returns the subcategories of parent, or the top-level
+// categories if it's empty.
+func (s *catalogService) GetCategories(ctx context.Context, parent string) ([]Category, error) {
+	parent = strings.ToLower(strings.TrimSpace(parent))
+
+	if parent != "" {
+		if _, err := s.repository.GetCategory(ctx, parent); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.repository.ListCategories(ctx, []string{parent})
+}
+
+// GetSubcategories returns the subcategories of all the parents at once.
+func (s *catalogService) GetSubcategories(ctx context.Context, parents []string) ([]Category, error) {
+	return s.repository.ListCategories(ctx, normalizeCategories(parents))
+}
+
+// GetCategoriesWithSlugs returns the categories with the given slugs, leaving
+// out the ones that don't exist.
+func (s *catalogService) GetCategoriesWithSlugs(ctx context.Context, slugs []string) ([]Category, error) {
+	return s.repository.ListCategoriesWithSlugs(ctx, normalizeCategories(slugs))
+}
+
+// SetProductCategories replaces the categories of a product, which must all
+// exist.
+func (s *catalogService) SetProductCategories(ctx context.Context, id string, categories []string) (*Product, error) {
+	categories = normalizeCategories(categories)
+	assigned, err := s.lookUpCategories(ctx, categories)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.repository.SetProductCategories(ctx, id, categories, categoryTree(assigned)); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetProductByID(ctx, id)
+}
+
+// DeleteCategory removes a category without subcategories or products.
+func (s *catalogService) DeleteCategory(ctx context.Context, slug string) error {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+
+	children, err := s.repository.ListCategories(ctx, []string{slug})
+
+	if err != nil {
+		return err
+	}
+
+	products, err := s.repository.CountProductsInCategory(ctx, slug)
+
+	if err != nil {
+		return err
+	}
+
+	if len(children) > 0 || products > 0 {
+		return ErrCategoryInUse
 	}
 
-	return s.repository.SearchProducts(ctx, query, skip, take)
+	return s.repository.DeleteCategory(ctx, slug)
 }
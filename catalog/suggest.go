@@ -0,0 +1,143 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Suggestion completes what a shopper is typing to the name of a product.
+// ProductID is the best match of the products with that name.
+type Suggestion struct {
+	Text      string
+	ProductID string
+}
+
+const (
+	// defaultSuggestions is the number of suggestions returned if no limit
+	// is given, maxSuggestions the most that can be asked for.
+	defaultSuggestions = 5
+	maxSuggestions     = 20
+	// maxPrefixLength bounds the prefixes that are looked up, longer ones
+	// are cut.
+	maxPrefixLength = 100
+)
+
+// suggestRequest builds the body of a search for the names starting with
+// prefix. Every word but the last must match a word of the name and the last
+// one the start of a word, so each keystroke narrows the suggestions down.
+// Whole words may have typos, which score lower than exact matches. Products
+// with the same name are collapsed into the best match. Since the last word
+// is matched exactly, names starting with prefix are also completed with
+// typos allowed anywhere, e.g. "runing sh" completes to "Running shoes".
+func suggestRequest(prefix string, limit int) map[string]interface{} {
+	return map[string]interface{}{
+		"size":    limit,
+		"_source": []string{"name"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []interface{}{
+					map[string]interface{}{
+						"multi_match": map[string]interface{}{
+							"query":     prefix,
+							"type":      "bool_prefix",
+							"fields":    []string{"name.suggest", "name.suggest._2gram", "name.suggest._3gram"},
+							"operator":  "and",
+							"fuzziness": "AUTO",
+						},
+					},
+					map[string]interface{}{
+						"match": map[string]interface{}{
+							"name": map[string]interface{}{"query": prefix, "operator": "and", "boost": 2},
+						},
+					},
+				},
+				"minimum_should_match": 1,
+			},
+		},
+		"collapse": map[string]interface{}{"field": "name.keyword"},
+		"sort": []interface{}{
+			map[string]interface{}{"_score": "desc"},
+			map[string]interface{}{"name.keyword": "asc"},
+		},
+		"suggest": map[string]interface{}{
+			"names": map[string]interface{}{
+				"prefix": prefix,
+				"completion": map[string]interface{}{
+					"field":           "name.complete",
+					"size":            limit,
+					"skip_duplicates": true,
+					"fuzzy":           map[string]interface{}{"fuzziness": "AUTO"},
+				},
+			},
+		},
+	}
+}
+
+// SuggestProducts returns up to limit product names completing prefix, best
+// matches first. Names matching prefix word by word come before names only
+// completed with typos in the last word.
+func (r *elasticRepository) SuggestProducts(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	body, err := json.Marshal(suggestRequest(prefix, limit))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(r.index),
+		r.client.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("error suggesting products: %s", res.String())
+	}
+
+	type match struct {
+		ID     string `json:"_id"`
+		Source struct {
+			Name string `json:"name"`
+		} `json:"_source"`
+	}
+
+	var searchResult struct {
+		Hits struct {
+			Hits []match `json:"hits"`
+		} `json:"hits"`
+		Suggest struct {
+			Names []struct {
+				Options []match `json:"options"`
+			} `json:"names"`
+		} `json:"suggest"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&searchResult); err != nil {
+		return nil, err
+	}
+
+	suggestions := []Suggestion{}
+	// Collapsing only merges names spelled exactly the same
+	seen := map[string]bool{}
+
+	matches := searchResult.Hits.Hits
+
+	for _, s := range searchResult.Suggest.Names {
+		matches = append(matches, s.Options...)
+	}
+
+	for _, m := range matches {
+		key := strings.ToLower(strings.Join(strings.Fields(m.Source.Name), " "))
+
+		if !seen[key] && len(suggestions) < limit {
+			seen[key] = true
+			suggestions = append(suggestions, Suggestion{Text: m.Source.Name, ProductID: m.ID})
+		}
+	}
+
+	return suggestions, nil
+}
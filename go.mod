@@ -5,11 +5,13 @@ go 1.23.4
 require (
 	github.com/99designs/gqlgen v0.17.63
 	github.com/elastic/go-elasticsearch/v8 v8.17.0
+	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/lib/pq v1.10.9
 	github.com/segmentio/ksuid v1.0.4
 	github.com/tinrab/retry v1.0.0
 	github.com/vektah/gqlparser/v2 v2.5.21
+	golang.org/x/crypto v0.31.0
 	google.golang.org/grpc v1.69.2
 	google.golang.org/protobuf v1.36.1
 )
@@ -3,19 +3,43 @@ package main
 import (
 	"context"
 	"log"
+	"strings"
 	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/account"
+	"github.com/azizkhan030/go-grpc-graphql/order"
 )
 
 type accountResolver struct {
 	server *Server
 }
 
-func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, error) {
+func (r *accountResolver) Orders(ctx context.Context, obj *Account, filter *OrderFilterInput, sort *OrderSort, pagination *PaginationInput) (*OrderConnection, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 
 	defer cancel()
 
-	orderList, err := r.server.orderClient.GetOrdersForAccount(ctx, obj.ID)
+	f := order.OrderFilter{}
+
+	if filter != nil {
+		f = filter.filter()
+	}
+
+	if sort != nil {
+		f.Sort = order.OrderSort(strings.ToLower(sort.String()))
+	}
+
+	if pagination != nil {
+		var err error
+
+		if f.Skip, f.Take, err = pagination.bounds(); err != nil {
+			return nil, err
+		}
+
+		f.Cursor = pagination.cursor()
+	}
+
+	page, err := loadersFromContext(ctx).orders(f).Load(ctx, obj.ID)
 
 	if err != nil {
 		log.Println(err)
@@ -23,27 +47,74 @@ func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, e
 		return nil, err
 	}
 
-	var orders []*Order
+	edges := []*OrderEdge{}
 
-	for _, o := range orderList {
-		var products []*OrderedProduct
+	if page == nil {
+		return &OrderConnection{Edges: edges, PageInfo: &PageInfo{}}, nil
+	}
 
-		for _, p := range o.Products {
-			products = append(products, &OrderedProduct{
-				ID:          p.ID,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-				Quantity:    int(p.Quantity),
-			})
-		}
-		orders = append(orders, &Order{
-			ID:         o.ID,
-			CreatedAt:  o.CreatedAt,
-			Products:   products,
-			TotalPrice: o.TotalPrice,
+	for i, o := range page.Orders {
+		edges = append(edges, &OrderEdge{
+			Cursor: page.Cursors[i],
+			Node:   newOrder(o),
 		})
 	}
 
-	return orders, nil
+	return &OrderConnection{
+		Edges:      edges,
+		PageInfo:   newPageInfo(page.Cursors, page.NextCursor, f.Skip > 0 || f.Cursor != ""),
+		TotalCount: int(page.TotalCount),
+	}, nil
+}
+
+func (r *accountResolver) Addresses(ctx context.Context, obj *Account) ([]*account.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	addresses, err := r.server.accountClient.GetAddresses(ctx, obj.ID)
+
+	if err != nil {
+		log.Println(err)
+
+		return nil, err
+	}
+
+	out := []*account.Address{}
+
+	for i := range addresses {
+		out = append(out, &addresses[i])
+	}
+
+	return out, nil
+}
+
+func (in OrderFilterInput) filter() order.OrderFilter {
+	f := order.OrderFilter{}
+
+	for _, id := range in.ProductIds {
+		f.ProductIDs = append(f.ProductIDs, localID(productType, id))
+	}
+
+	if in.CreatedFrom != nil {
+		f.CreatedFrom = *in.CreatedFrom
+	}
+
+	if in.CreatedTo != nil {
+		f.CreatedTo = *in.CreatedTo
+	}
+
+	if in.MinTotal != nil {
+		f.MinTotal = *in.MinTotal
+	}
+
+	if in.MaxTotal != nil {
+		f.MaxTotal = *in.MaxTotal
+	}
+
+	for _, s := range in.Statuses {
+		f.Statuses = append(f.Statuses, order.Status(strings.ToLower(s.String())))
+	}
+
+	return f
 }
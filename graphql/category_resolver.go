@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/catalog"
+)
+
+type categoryResolver struct {
+	server *Server
+}
+
+func (r *categoryResolver) Parent(ctx context.Context, obj *catalog.Category) (*catalog.Category, error) {
+	if obj.Parent == "" {
+		return nil, nil
+	}
+
+	c, err := loadersFromContext(ctx).categories.Load(ctx, obj.Parent)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (r *categoryResolver) Children(ctx context.Context, obj *catalog.Category) ([]*catalog.Category, error) {
+	children, err := loadersFromContext(ctx).subcategories.Load(ctx, obj.Slug)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return children, nil
+}
+
+func (r *categoryResolver) Products(ctx context.Context, obj *catalog.Category, pagination *PaginationInput, query *string, currency *string, filter *ProductFilterInput, sort *ProductSort) (*ProductConnection, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	c := ""
+	if currency != nil {
+		c = *currency
+	}
+
+	s := productSearch(query, filter, sort)
+	s.Filter.Categories = []string{obj.Slug}
+
+	return r.server.searchProducts(ctx, s, pagination, c)
+}
+
+// categories returns the subcategories of parent, or the top-level
+// categories if it's empty.
+func (s *Server) categories(ctx context.Context, parent string) ([]*catalog.Category, error) {
+	categories, err := s.catalogClient.GetCategories(ctx, parent)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	out := []*catalog.Category{}
+
+	for i := range categories {
+		out = append(out, &categories[i])
+	}
+
+	return out, nil
+}
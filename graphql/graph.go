@@ -60,8 +60,23 @@ func (s *Server) Account() AccountResolver {
 	}
 }
 
+func (s *Server) Order() OrderResolver {
+	return &orderResolver{
+		server: s,
+	}
+}
+
+func (s *Server) Category() CategoryResolver {
+	return &categoryResolver{
+		server: s,
+	}
+}
+
 func (s *Server) ToExecutableSchema() graphql.ExecutableSchema {
 	return NewExecutableSchema(Config{
 		Resolvers: s,
+		Directives: DirectiveRoot{
+			HasRole: hasRoleDirective,
+		},
 	})
 }
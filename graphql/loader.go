@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/catalog"
+	"github.com/azizkhan030/go-grpc-graphql/order"
+)
+
+const (
+	loaderWait     = 2 * time.Millisecond
+	loaderMaxBatch = 100
+)
+
+type batchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+type loaderResult[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// loader collects the keys requested by concurrently running resolvers and
+// fetches them with a single batch call. Results are memoized, so a loader
+// must only live as long as one request.
+type loader[K comparable, V any] struct {
+	ctx     context.Context
+	fetch   batchFunc[K, V]
+	mu      sync.Mutex
+	results map[K]*loaderResult[V]
+	pending []K
+	timer   *time.Timer
+}
+
+func newLoader[K comparable, V any](ctx context.Context, fetch batchFunc[K, V]) *loader[K, V] {
+	return &loader[K, V]{
+		ctx:     ctx,
+		fetch:   fetch,
+		results: map[K]*loaderResult[V]{},
+	}
+}
+
+func (l *loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+
+	res, ok := l.results[key]
+
+	if !ok {
+		res = &loaderResult[V]{done: make(chan struct{})}
+		l.results[key] = res
+		l.pending = append(l.pending, key)
+
+		if len(l.pending) >= loaderMaxBatch {
+			l.dispatchLocked()
+		} else if l.timer == nil {
+			l.timer = time.AfterFunc(loaderWait, l.dispatch)
+		}
+	}
+
+	l.mu.Unlock()
+
+	select {
+	case <-res.done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *loader[K, V]) dispatch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.dispatchLocked()
+}
+
+func (l *loader[K, V]) dispatchLocked() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+
+	if len(l.pending) == 0 {
+		return
+	}
+
+	keys := l.pending
+	l.pending = nil
+
+	results := make([]*loaderResult[V], len(keys))
+
+	for i, key := range keys {
+		results[i] = l.results[key]
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(l.ctx, 3*time.Second)
+
+		defer cancel()
+
+		values, err := l.fetch(ctx, keys)
+
+		for i, key := range keys {
+			results[i].value, results[i].err = values[key], err
+			close(results[i].done)
+		}
+	}()
+}
+
+type loaders struct {
+	ctx             context.Context
+	orderClient     *order.Client
+	mu              sync.Mutex
+	ordersByAccount map[string]*loader[string, *order.OrderPage]
+	// categories loads categories by slug, subcategories the children of
+	// categories by the parent's slug
+	categories    *loader[string, *catalog.Category]
+	subcategories *loader[string, []*catalog.Category]
+}
+
+// orders returns the loader of account orders matching the filter. Resolvers
+// asking for the same filter share a loader, so their accounts are fetched
+// with a single call.
+func (l *loaders) orders(f order.OrderFilter) *loader[string, *order.OrderPage] {
+	key := fmt.Sprintf("%+v", f)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ld, ok := l.ordersByAccount[key]; ok {
+		return ld
+	}
+
+	ld := newLoader(l.ctx, func(ctx context.Context, accountIDs []string) (map[string]*order.OrderPage, error) {
+		return l.orderClient.GetOrdersForAccounts(ctx, accountIDs, f)
+	})
+	l.ordersByAccount[key] = ld
+
+	return ld
+}
+
+// categoriesBySlug fetches the categories with the given slugs.
+func (s *Server) categoriesBySlug(ctx context.Context, slugs []string) (map[string]*catalog.Category, error) {
+	categories, err := s.catalogClient.GetCategoriesWithSlugs(ctx, slugs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]*catalog.Category{}
+
+	for i := range categories {
+		out[categories[i].Slug] = &categories[i]
+	}
+
+	return out, nil
+}
+
+// subcategoriesByParent fetches the children of the given categories. Every
+// parent gets a list, empty if it has no children.
+func (s *Server) subcategoriesByParent(ctx context.Context, parents []string) (map[string][]*catalog.Category, error) {
+	categories, err := s.catalogClient.GetSubcategories(ctx, parents)
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string][]*catalog.Category{}
+
+	for _, parent := range parents {
+		out[parent] = []*catalog.Category{}
+	}
+
+	for i := range categories {
+		out[categories[i].Parent] = append(out[categories[i].Parent], &categories[i])
+	}
+
+	return out, nil
+}
+
+type loadersKey struct{}
+
+// loaderMiddleware gives every request its own set of loaders. They use the
+// request context, so batched calls carry the caller's credentials.
+func loaderMiddleware(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		l := &loaders{
+			ctx:             ctx,
+			orderClient:     s.orderClient,
+			ordersByAccount: map[string]*loader[string, *order.OrderPage]{},
+			categories:      newLoader(ctx, s.categoriesBySlug),
+			subcategories:   newLoader(ctx, s.subcategoriesByParent),
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, loadersKey{}, l)))
+	})
+}
+
+func loadersFromContext(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
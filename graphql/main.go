@@ -6,13 +6,15 @@ import (
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type AppConfig struct {
-	AccountURL string `envconfig: "ACCOUNT_SERVICE_URL"`
+	AccountURL string `envconfig:"ACCOUNT_SERVICE_URL"`
 	CatalogURL string `envconfig:"CATALOG_SERVICE_URL"`
 	OrderURL   string `envconfig:"ORDER_SERVICE_URL"`
+	JWTSecret  string `envconfig:"JWT_SECRET" required:"true"`
 }
 
 func main() {
@@ -24,13 +26,19 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err = auth.CheckSecret(cfg.JWTSecret); err != nil {
+		log.Fatal(err)
+	}
+
 	s, err := NewGraphQLServer(cfg.AccountURL, cfg.CatalogURL, cfg.OrderURL)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	http.Handle("/graphql", handler.New(s.ToExecutableSchema()))
+	tokens := auth.NewTokenIssuer(cfg.JWTSecret, 0)
+
+	http.Handle("/graphql", authMiddleware(tokens, loaderMiddleware(s, handler.New(s.ToExecutableSchema()))))
 	http.Handle("/playground", playground.Handler("azizbek", "/graphql"))
 
 	log.Fatal(http.ListenAndServe(":8080", nil))
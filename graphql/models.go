@@ -1,7 +1,93 @@
 package main
 
+import (
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/catalog"
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
 type Account struct {
-	ID     string  `json:"id"`
-	Name   string  `json:"name"`
-	Orders []Order `json:"orders"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Product struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	Price        money.Money   `json:"price"`
+	Prices       []money.Money `json:"prices"`
+	ExchangeRate *string       `json:"exchangeRate"`
+	Stock        int           `json:"stock"`
+	TaxCategory  string        `json:"taxCategory"`
+	Categories   []string      `json:"categories"`
+}
+
+type Order struct {
+	ID              string               `json:"id"`
+	AccountID       string               `json:"accountId"`
+	CreatedAt       time.Time            `json:"createdAt"`
+	Subtotal        money.Money          `json:"subtotal"`
+	Discounts       []*Discount          `json:"discounts"`
+	Tax             money.Money          `json:"tax"`
+	TotalPrice      money.Money          `json:"totalPrice"`
+	Currency        string               `json:"currency"`
+	TaxRegion       *string              `json:"taxRegion"`
+	ShippingAddress *ShippingAddress     `json:"shippingAddress"`
+	Products        []*OrderedProduct    `json:"products"`
+	Status          OrderStatus          `json:"status"`
+	StatusHistory   []*OrderStatusChange `json:"statusHistory"`
+	Payment         *Payment             `json:"payment"`
+	Refunds         []*Refund            `json:"refunds"`
+}
+
+func newProduct(p catalog.Product) *Product {
+	product := &Product{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Prices:      p.Prices,
+		Stock:       int(p.Stock),
+		TaxCategory: p.TaxCategory,
+		Categories:  p.Categories,
+	}
+
+	if product.Prices == nil {
+		product.Prices = []money.Money{}
+	}
+
+	if product.Categories == nil {
+		product.Categories = []string{}
+	}
+
+	if p.ExchangeRate != "" {
+		product.ExchangeRate = &p.ExchangeRate
+	}
+
+	return product
+}
+
+func newFacets(facets []catalog.Facet) []*Facet {
+	out := []*Facet{}
+
+	for _, f := range facets {
+		facet := &Facet{Name: f.Name, Buckets: []*FacetBucket{}}
+
+		for _, b := range f.Buckets {
+			bucket := &FacetBucket{Key: b.Key, Count: int(b.Count)}
+
+			if b.From.Currency != "" {
+				from, to := b.From, b.To
+				bucket.From, bucket.To = &from, &to
+			}
+
+			facet.Buckets = append(facet.Buckets, bucket)
+		}
+
+		out = append(out, facet)
+	}
+
+	return out
 }
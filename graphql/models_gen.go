@@ -3,34 +3,189 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
 )
 
+type Node interface {
+	IsNode()
+	GetID() string
+}
+
+type AccountConnection struct {
+	Edges      []*AccountEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+}
+
+type AccountEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Account `json:"node"`
+}
+
 type AccountInput struct {
 	Name string `json:"name"`
 }
 
+type AddressInput struct {
+	Name       string  `json:"name"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2,omitempty"`
+	City       string  `json:"city"`
+	Region     *string `json:"region,omitempty"`
+	PostalCode *string `json:"postalCode,omitempty"`
+	Country    string  `json:"country"`
+}
+
+type AuthPayload struct {
+	AccessToken string   `json:"accessToken"`
+	Account     *Account `json:"account"`
+}
+
+type Cart struct {
+	Items    []*CartItem `json:"items"`
+	Subtotal money.Money `json:"subtotal"`
+}
+
+type CartItem struct {
+	ProductID    string       `json:"productId"`
+	Name         *string      `json:"name,omitempty"`
+	Price        *money.Money `json:"price,omitempty"`
+	ExchangeRate *string      `json:"exchangeRate,omitempty"`
+	Quantity     int          `json:"quantity"`
+	AddedAt      time.Time    `json:"addedAt"`
+	Available    bool         `json:"available"`
+}
+
+type CategoryInput struct {
+	Name   string  `json:"name"`
+	Slug   string  `json:"slug"`
+	Parent *string `json:"parent,omitempty"`
+}
+
+type CheckoutInput struct {
+	IdempotencyKey  *string       `json:"idempotencyKey,omitempty"`
+	CouponCode      *string       `json:"couponCode,omitempty"`
+	Region          *string       `json:"region,omitempty"`
+	AddressID       *string       `json:"addressId,omitempty"`
+	ShippingAddress *AddressInput `json:"shippingAddress,omitempty"`
+}
+
+type Coupon struct {
+	Code          string       `json:"code"`
+	Kind          CouponKind   `json:"kind"`
+	Percent       int          `json:"percent"`
+	Amount        *money.Money `json:"amount,omitempty"`
+	ProductID     *string      `json:"productId,omitempty"`
+	BuyQuantity   int          `json:"buyQuantity"`
+	FreeQuantity  int          `json:"freeQuantity"`
+	MinOrderValue *money.Money `json:"minOrderValue,omitempty"`
+	UsageLimit    int          `json:"usageLimit"`
+	ExpiresAt     *time.Time   `json:"expiresAt,omitempty"`
+}
+
+type CouponInput struct {
+	Code          string       `json:"code"`
+	Kind          CouponKind   `json:"kind"`
+	Percent       *int         `json:"percent,omitempty"`
+	Amount        *money.Money `json:"amount,omitempty"`
+	ProductID     *string      `json:"productId,omitempty"`
+	BuyQuantity   *int         `json:"buyQuantity,omitempty"`
+	FreeQuantity  *int         `json:"freeQuantity,omitempty"`
+	MinOrderValue *money.Money `json:"minOrderValue,omitempty"`
+	UsageLimit    *int         `json:"usageLimit,omitempty"`
+	ExpiresAt     *time.Time   `json:"expiresAt,omitempty"`
+}
+
+type Discount struct {
+	CouponCode  string      `json:"couponCode"`
+	Description string      `json:"description"`
+	Amount      money.Money `json:"amount"`
+}
+
+type ExchangeRate struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Rate string `json:"rate"`
+}
+
+type Facet struct {
+	Name    string         `json:"name"`
+	Buckets []*FacetBucket `json:"buckets"`
+}
+
+type FacetBucket struct {
+	Key   string       `json:"key"`
+	Count int          `json:"count"`
+	From  *money.Money `json:"from,omitempty"`
+	To    *money.Money `json:"to,omitempty"`
+}
+
 type Mutation struct {
 }
 
-type Order struct {
-	ID         string            `json:"id"`
-	CreatedAt  time.Time         `json:"createdAt"`
-	TotalPrice float64           `json:"totalPrice"`
-	Products   []*OrderedProduct `json:"products"`
+type OrderConnection struct {
+	Edges      []*OrderEdge `json:"edges"`
+	PageInfo   *PageInfo    `json:"pageInfo"`
+	TotalCount int          `json:"totalCount"`
+}
+
+type OrderEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Order `json:"node"`
+}
+
+type OrderFilterInput struct {
+	CreatedFrom *time.Time    `json:"createdFrom,omitempty"`
+	CreatedTo   *time.Time    `json:"createdTo,omitempty"`
+	Statuses    []OrderStatus `json:"statuses,omitempty"`
+	MinTotal    *money.Money  `json:"minTotal,omitempty"`
+	MaxTotal    *money.Money  `json:"maxTotal,omitempty"`
+	ProductIds  []string      `json:"productIds,omitempty"`
 }
 
 type OrderInput struct {
-	AccountID string                 `json:"accountId"`
-	Products  []*OrderedProductInput `json:"products"`
+	AccountID       *string                `json:"accountId,omitempty"`
+	Products        []*OrderedProductInput `json:"products"`
+	IdempotencyKey  *string                `json:"idempotencyKey,omitempty"`
+	CouponCode      *string                `json:"couponCode,omitempty"`
+	Region          *string                `json:"region,omitempty"`
+	AddressID       *string                `json:"addressId,omitempty"`
+	ShippingAddress *AddressInput          `json:"shippingAddress,omitempty"`
+}
+
+type OrderPreview struct {
+	Products        []*OrderedProduct `json:"products"`
+	Subtotal        money.Money       `json:"subtotal"`
+	Discounts       []*Discount       `json:"discounts"`
+	Tax             money.Money       `json:"tax"`
+	TotalPrice      money.Money       `json:"totalPrice"`
+	Currency        string            `json:"currency"`
+	TaxRegion       *string           `json:"taxRegion,omitempty"`
+	ShippingAddress *ShippingAddress  `json:"shippingAddress,omitempty"`
+}
+
+type OrderStatusChange struct {
+	Status    OrderStatus `json:"status"`
+	ChangedAt time.Time   `json:"changedAt"`
+	Actor     string      `json:"actor"`
+	Reason    *string     `json:"reason,omitempty"`
 }
 
 type OrderedProduct struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description"`
+	Price        money.Money `json:"price"`
+	Currency     string      `json:"currency"`
+	ExchangeRate *string     `json:"exchangeRate,omitempty"`
+	TaxCategory  string      `json:"taxCategory"`
+	Tax          money.Money `json:"tax"`
+	Quantity     int         `json:"quantity"`
 }
 
 type OrderedProductInput struct {
@@ -38,23 +193,418 @@ type OrderedProductInput struct {
 	Quantity int    `json:"quantity"`
 }
 
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
 type PaginationInput struct {
-	Skip *int `json:"skip,omitempty"`
-	Take *int `json:"take,omitempty"`
+	Skip   *int    `json:"skip,omitempty"`
+	Take   *int    `json:"take,omitempty"`
+	Cursor *string `json:"cursor,omitempty"`
+}
+
+type Payment struct {
+	Provider  string        `json:"provider"`
+	Reference string        `json:"reference"`
+	Status    PaymentStatus `json:"status"`
+	Amount    money.Money   `json:"amount"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+type ProductConnection struct {
+	Edges      []*ProductEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+	Facets     []*Facet       `json:"facets"`
 }
 
-type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+type ProductEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Product `json:"node"`
+}
+
+type ProductFilterInput struct {
+	Categories []string     `json:"categories,omitempty"`
+	MinPrice   *money.Money `json:"minPrice,omitempty"`
+	MaxPrice   *money.Money `json:"maxPrice,omitempty"`
+	InStock    *bool        `json:"inStock,omitempty"`
 }
 
 type ProductInput struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"Price"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Price       money.Money    `json:"Price"`
+	Prices      []*money.Money `json:"prices,omitempty"`
+	Stock       *int           `json:"stock,omitempty"`
+	TaxCategory *string        `json:"taxCategory,omitempty"`
+	Categories  []string       `json:"categories,omitempty"`
+}
+
+type ProductSuggestion struct {
+	Text      string `json:"text"`
+	ProductID string `json:"productId"`
 }
 
 type Query struct {
 }
+
+type Refund struct {
+	ID        string        `json:"id"`
+	Reference string        `json:"reference"`
+	Status    RefundStatus  `json:"status"`
+	Amount    money.Money   `json:"amount"`
+	Reason    string        `json:"reason"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Lines     []*RefundLine `json:"lines"`
+}
+
+type RefundLine struct {
+	ProductID string      `json:"productId"`
+	Quantity  int         `json:"quantity"`
+	Amount    money.Money `json:"amount"`
+}
+
+type RefundLineInput struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+type RegisterInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ShippingAddress struct {
+	AddressID  *string `json:"addressId,omitempty"`
+	Name       string  `json:"name"`
+	Line1      string  `json:"line1"`
+	Line2      string  `json:"line2"`
+	City       string  `json:"city"`
+	Region     string  `json:"region"`
+	PostalCode string  `json:"postalCode"`
+	Country    string  `json:"country"`
+}
+
+type CouponKind string
+
+const (
+	CouponKindPercentage CouponKind = "PERCENTAGE"
+	CouponKindFixed      CouponKind = "FIXED"
+	CouponKindBuyXGetY   CouponKind = "BUY_X_GET_Y"
+)
+
+var AllCouponKind = []CouponKind{
+	CouponKindPercentage,
+	CouponKindFixed,
+	CouponKindBuyXGetY,
+}
+
+func (e CouponKind) IsValid() bool {
+	switch e {
+	case CouponKindPercentage, CouponKindFixed, CouponKindBuyXGetY:
+		return true
+	}
+	return false
+}
+
+func (e CouponKind) String() string {
+	return string(e)
+}
+
+func (e *CouponKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CouponKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CouponKind", str)
+	}
+	return nil
+}
+
+func (e CouponKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderSort string
+
+const (
+	OrderSortCreatedAtAsc  OrderSort = "CREATED_AT_ASC"
+	OrderSortCreatedAtDesc OrderSort = "CREATED_AT_DESC"
+	OrderSortTotalAsc      OrderSort = "TOTAL_ASC"
+	OrderSortTotalDesc     OrderSort = "TOTAL_DESC"
+)
+
+var AllOrderSort = []OrderSort{
+	OrderSortCreatedAtAsc,
+	OrderSortCreatedAtDesc,
+	OrderSortTotalAsc,
+	OrderSortTotalDesc,
+}
+
+func (e OrderSort) IsValid() bool {
+	switch e {
+	case OrderSortCreatedAtAsc, OrderSortCreatedAtDesc, OrderSortTotalAsc, OrderSortTotalDesc:
+		return true
+	}
+	return false
+}
+
+func (e OrderSort) String() string {
+	return string(e)
+}
+
+func (e *OrderSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderSort", str)
+	}
+	return nil
+}
+
+func (e OrderSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "PENDING"
+	OrderStatusPaid      OrderStatus = "PAID"
+	OrderStatusFulfilled OrderStatus = "FULFILLED"
+	OrderStatusCancelled OrderStatus = "CANCELLED"
+	OrderStatusRefunded  OrderStatus = "REFUNDED"
+)
+
+var AllOrderStatus = []OrderStatus{
+	OrderStatusPending,
+	OrderStatusPaid,
+	OrderStatusFulfilled,
+	OrderStatusCancelled,
+	OrderStatusRefunded,
+}
+
+func (e OrderStatus) IsValid() bool {
+	switch e {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusFulfilled, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e OrderStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderStatus", str)
+	}
+	return nil
+}
+
+func (e OrderStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending    PaymentStatus = "PENDING"
+	PaymentStatusAuthorized PaymentStatus = "AUTHORIZED"
+	PaymentStatusCaptured   PaymentStatus = "CAPTURED"
+	PaymentStatusDeclined   PaymentStatus = "DECLINED"
+	PaymentStatusVoided     PaymentStatus = "VOIDED"
+	PaymentStatusRefunded   PaymentStatus = "REFUNDED"
+	PaymentStatusVoidFailed PaymentStatus = "VOID_FAILED"
+)
+
+var AllPaymentStatus = []PaymentStatus{
+	PaymentStatusPending,
+	PaymentStatusAuthorized,
+	PaymentStatusCaptured,
+	PaymentStatusDeclined,
+	PaymentStatusVoided,
+	PaymentStatusRefunded,
+	PaymentStatusVoidFailed,
+}
+
+func (e PaymentStatus) IsValid() bool {
+	switch e {
+	case PaymentStatusPending, PaymentStatusAuthorized, PaymentStatusCaptured, PaymentStatusDeclined, PaymentStatusVoided, PaymentStatusRefunded, PaymentStatusVoidFailed:
+		return true
+	}
+	return false
+}
+
+func (e PaymentStatus) String() string {
+	return string(e)
+}
+
+func (e *PaymentStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PaymentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PaymentStatus", str)
+	}
+	return nil
+}
+
+func (e PaymentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductSort string
+
+const (
+	ProductSortRelevance ProductSort = "RELEVANCE"
+	ProductSortNewest    ProductSort = "NEWEST"
+	ProductSortPriceAsc  ProductSort = "PRICE_ASC"
+	ProductSortPriceDesc ProductSort = "PRICE_DESC"
+	ProductSortNameAsc   ProductSort = "NAME_ASC"
+	ProductSortNameDesc  ProductSort = "NAME_DESC"
+)
+
+var AllProductSort = []ProductSort{
+	ProductSortRelevance,
+	ProductSortNewest,
+	ProductSortPriceAsc,
+	ProductSortPriceDesc,
+	ProductSortNameAsc,
+	ProductSortNameDesc,
+}
+
+func (e ProductSort) IsValid() bool {
+	switch e {
+	case ProductSortRelevance, ProductSortNewest, ProductSortPriceAsc, ProductSortPriceDesc, ProductSortNameAsc, ProductSortNameDesc:
+		return true
+	}
+	return false
+}
+
+func (e ProductSort) String() string {
+	return string(e)
+}
+
+func (e *ProductSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductSort", str)
+	}
+	return nil
+}
+
+func (e ProductSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "PENDING"
+	RefundStatusSucceeded RefundStatus = "SUCCEEDED"
+	RefundStatusFailed    RefundStatus = "FAILED"
+)
+
+var AllRefundStatus = []RefundStatus{
+	RefundStatusPending,
+	RefundStatusSucceeded,
+	RefundStatusFailed,
+}
+
+func (e RefundStatus) IsValid() bool {
+	switch e {
+	case RefundStatusPending, RefundStatusSucceeded, RefundStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e RefundStatus) String() string {
+	return string(e)
+}
+
+func (e *RefundStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RefundStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RefundStatus", str)
+	}
+	return nil
+}
+
+func (e RefundStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Role string
+
+const (
+	RoleCustomer Role = "CUSTOMER"
+	RoleAdmin    Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleCustomer,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleCustomer, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+// MarshalMoney writes amounts as strings in major units with the currency
+// code, e.g. "19.99 USD", so clients never see a rounded float.
+func MarshalMoney(m money.Money) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, strconv.Quote(m.String()))
+	})
+}
+
+func UnmarshalMoney(v interface{}) (money.Money, error) {
+	s, ok := v.(string)
+
+	if !ok {
+		return money.Money{}, fmt.Errorf("%w: must be a string like \"19.99 USD\"", money.ErrInvalidAmount)
+	}
+
+	return money.Parse(s)
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"errors"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/azizkhan030/go-grpc-graphql/account"
+	"github.com/azizkhan030/go-grpc-graphql/auth"
+	"github.com/azizkhan030/go-grpc-graphql/catalog"
+	"github.com/azizkhan030/go-grpc-graphql/money"
 	"github.com/azizkhan030/go-grpc-graphql/order"
 )
 
@@ -36,12 +41,67 @@ func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput) (
 	}, nil
 }
 
-func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (*Product, error) {
+func (r *mutationResolver) UpdateAccount(ctx context.Context, id string, in AccountInput) (*Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	a, err := r.server.accountClient.UpdateAccount(ctx, localID(accountType, id), in.Name)
+
+	if err != nil {
+		log.Println(err)
+
+		return nil, err
+	}
+
+	return &Account{
+		ID:   a.ID,
+		Name: a.Name,
+	}, nil
+}
+
+func (r *mutationResolver) DeleteAccount(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	if err := r.server.accountClient.DeleteAccount(ctx, localID(accountType, id)); err != nil {
+		log.Println(err)
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) Register(ctx context.Context, in RegisterInput) (*AuthPayload, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	a, token, err := r.server.accountClient.Register(ctx, in.Name, in.Email, in.Password)
+
+	if err != nil {
+		log.Println(err)
+
+		return nil, err
+	}
+
+	return &AuthPayload{
+		AccessToken: token,
+		Account: &Account{
+			ID:   a.ID,
+			Name: a.Name,
+		},
+	}, nil
+}
+
+func (r *mutationResolver) Login(ctx context.Context, email string, password string) (*AuthPayload, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 
 	defer cancel()
 
-	p, err := r.server.catalogClient.PostProduct(ctx, in.Name, in.Description, in.Price)
+	a, token, err := r.server.accountClient.Login(ctx, email, password)
 
 	if err != nil {
 		log.Println(err)
@@ -49,42 +109,479 @@ func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (
 		return nil, err
 	}
 
-	return &Product{
-		ID:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
+	return &AuthPayload{
+		AccessToken: token,
+		Account: &Account{
+			ID:   a.ID,
+			Name: a.Name,
+		},
 	}, nil
+}
+
+func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	stock := 0
+
+	if in.Stock != nil {
+		stock = *in.Stock
+	}
+
+	if stock < 0 {
+		return nil, ErrInValidParameter
+	}
+
+	prices := []money.Money{}
+
+	for _, price := range in.Prices {
+		prices = append(prices, *price)
+	}
+
+	taxCategory := ""
+
+	if in.TaxCategory != nil {
+		taxCategory = *in.TaxCategory
+	}
+
+	p, err := r.server.catalogClient.PostProduct(ctx, in.Name, in.Description, taxCategory, in.Categories, in.Price, prices, uint32(stock))
+
+	if err != nil {
+		log.Println(err)
+
+		return nil, err
+	}
+
+	return newProduct(*p), nil
 
 }
 
-func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Order, error) {
+func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput, currency *string) (*Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 
 	defer cancel()
 
+	accountID, products, err := orderRequest(ctx, in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := r.server.orderClient.PostOrder(ctx, accountID, stringValue(in.IdempotencyKey), in.checkout(currency), products)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newOrder(*o), nil
+}
+
+// orderRequest returns the account an order input is placed for, which must
+// be the caller's, and the requested products.
+func orderRequest(ctx context.Context, in OrderInput) (string, []order.OrderedProduct, error) {
+	accountID, ok := accountIDFromContext(ctx)
+
+	if !ok {
+		return "", nil, auth.ErrUnauthenticated
+	}
+
+	if in.AccountID != nil && localID(accountType, *in.AccountID) != accountID {
+		return "", nil, auth.ErrForbidden
+	}
+
 	var products []order.OrderedProduct
 
 	for _, p := range in.Products {
 		if p.Quantity <= 0 {
-			return nil, ErrInValidParameter
+			return "", nil, ErrInValidParameter
 		}
 		products = append(products, order.OrderedProduct{
-			ID:       p.ID,
+			ID:       localID(productType, p.ID),
 			Quantity: uint32(p.Quantity),
 		})
 	}
 
-	o, err := r.server.orderClient.PostOrder(ctx, in.AccountID, products)
+	return accountID, products, nil
+}
+
+// checkout returns the options the order input is placed with.
+func (in OrderInput) checkout(currency *string) order.Checkout {
+	return order.Checkout{
+		Currency:        stringValue(currency),
+		Region:          stringValue(in.Region),
+		CouponCode:      stringValue(in.CouponCode),
+		ShippingAddress: shippingAddress(in.AddressID, in.ShippingAddress),
+	}
+}
+
+func (in CheckoutInput) checkout(currency *string) order.Checkout {
+	return order.Checkout{
+		Currency:        stringValue(currency),
+		Region:          stringValue(in.Region),
+		CouponCode:      stringValue(in.CouponCode),
+		ShippingAddress: shippingAddress(in.AddressID, in.ShippingAddress),
+	}
+}
+
+// shippingAddress returns the saved address with the given ID, if any, or
+// else the inline one.
+func shippingAddress(addressID *string, in *AddressInput) *account.Address {
+	if addressID != nil {
+		return &account.Address{ID: *addressID}
+	}
+
+	if in == nil {
+		return nil
+	}
+
+	a := newAddress(*in)
+
+	return &a
+}
+
+func newAddress(in AddressInput) account.Address {
+	return account.Address{
+		Name:       in.Name,
+		Line1:      in.Line1,
+		Line2:      stringValue(in.Line2),
+		City:       in.City,
+		Region:     stringValue(in.Region),
+		PostalCode: stringValue(in.PostalCode),
+		Country:    in.Country,
+	}
+}
+
+func (r *mutationResolver) TransitionOrder(ctx context.Context, id string, status OrderStatus) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	o, err := r.server.orderClient.TransitionOrder(ctx, localID(orderType, id), order.Status(strings.ToLower(status.String())))
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newOrder(*o), nil
+}
+
+func (r *mutationResolver) PayOrder(ctx context.Context, id string, paymentToken string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+
+	defer cancel()
+
+	o, err := r.server.orderClient.PayOrder(ctx, localID(orderType, id), paymentToken)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newOrder(*o), nil
+}
+
+func (r *mutationResolver) CancelOrder(ctx context.Context, id string, reason string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+
+	defer cancel()
+
+	o, err := r.server.orderClient.CancelOrder(ctx, localID(orderType, id), reason)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newOrder(*o), nil
+}
+
+func (r *mutationResolver) RefundOrderLines(ctx context.Context, id string, lines []*RefundLineInput, reason string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+
+	defer cancel()
+
+	refundLines := []order.RefundLine{}
+
+	for _, l := range lines {
+		if l.Quantity <= 0 {
+			return nil, ErrInValidParameter
+		}
+
+		refundLines = append(refundLines, order.RefundLine{ProductID: localID(productType, l.ProductID), Quantity: uint32(l.Quantity)})
+	}
+
+	o, err := r.server.orderClient.RefundOrderLines(ctx, localID(orderType, id), refundLines, reason)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newOrder(*o), nil
+}
+
+func (r *mutationResolver) SetExchangeRate(ctx context.Context, from string, to string, rate string) (*ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	res, err := r.server.catalogClient.SetExchangeRate(ctx, from, to, rate)
 
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	return &Order{
-		ID:         o.ID,
-		CreatedAt:  o.CreatedAt,
-		TotalPrice: o.TotalPrice,
+	return &ExchangeRate{
+		From: res.From,
+		To:   res.To,
+		Rate: res.Value,
 	}, nil
 }
+
+func (r *mutationResolver) CreateCategory(ctx context.Context, in CategoryInput) (*catalog.Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	parent := ""
+
+	if in.Parent != nil {
+		parent = *in.Parent
+	}
+
+	c, err := r.server.catalogClient.PostCategory(ctx, in.Name, in.Slug, parent)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (r *mutationResolver) DeleteCategory(ctx context.Context, slug string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	if err := r.server.catalogClient.DeleteCategory(ctx, slug); err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) SetProductCategories(ctx context.Context, id string, categories []string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	p, err := r.server.catalogClient.SetProductCategories(ctx, localID(productType, id), categories)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newProduct(*p), nil
+}
+
+func (r *mutationResolver) CreateCoupon(ctx context.Context, in CouponInput) (*Coupon, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	for _, n := range []*int{in.Percent, in.BuyQuantity, in.FreeQuantity, in.UsageLimit} {
+		if n != nil && *n < 0 {
+			return nil, ErrInValidParameter
+		}
+	}
+
+	c := order.Coupon{
+		Code:         in.Code,
+		Kind:         order.CouponKind(strings.ToLower(in.Kind.String())),
+		Percent:      uint32(intValue(in.Percent)),
+		BuyQuantity:  uint32(intValue(in.BuyQuantity)),
+		FreeQuantity: uint32(intValue(in.FreeQuantity)),
+		UsageLimit:   uint32(intValue(in.UsageLimit)),
+	}
+
+	if in.Amount != nil {
+		c.Amount = *in.Amount
+	}
+
+	if in.MinOrderValue != nil {
+		c.MinOrderValue = *in.MinOrderValue
+	}
+
+	if in.ProductID != nil {
+		c.ProductID = localID(productType, *in.ProductID)
+	}
+
+	if in.ExpiresAt != nil {
+		c.ExpiresAt = *in.ExpiresAt
+	}
+
+	created, err := r.server.orderClient.CreateCoupon(ctx, c)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newCoupon(*created), nil
+}
+
+func (r *mutationResolver) CreateAddress(ctx context.Context, in AddressInput, accountID *string) (*account.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	a := newAddress(in)
+
+	if accountID != nil {
+		a.AccountID = localID(accountType, *accountID)
+	} else if id, ok := accountIDFromContext(ctx); ok {
+		a.AccountID = id
+	}
+
+	created, err := r.server.accountClient.CreateAddress(ctx, a)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (r *mutationResolver) UpdateAddress(ctx context.Context, id string, in AddressInput) (*account.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	a := newAddress(in)
+	a.ID = id
+
+	updated, err := r.server.accountClient.UpdateAddress(ctx, a)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (r *mutationResolver) DeleteAddress(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	if err := r.server.accountClient.DeleteAddress(ctx, id); err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) AddToCart(ctx context.Context, productID string, quantity int, currency *string) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	accountID, ok := accountIDFromContext(ctx)
+
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	if quantity <= 0 {
+		return nil, ErrInValidParameter
+	}
+
+	c, err := r.server.orderClient.AddToCart(ctx, accountID, localID(productType, productID), uint32(quantity), stringValue(currency))
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newCart(*c), nil
+}
+
+func (r *mutationResolver) UpdateCartItem(ctx context.Context, productID string, quantity int, currency *string) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	accountID, ok := accountIDFromContext(ctx)
+
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	if quantity < 0 {
+		return nil, ErrInValidParameter
+	}
+
+	c, err := r.server.orderClient.UpdateCartItem(ctx, accountID, localID(productType, productID), uint32(quantity), stringValue(currency))
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newCart(*c), nil
+}
+
+func (r *mutationResolver) RemoveFromCart(ctx context.Context, productID string, currency *string) (*Cart, error) {
+	return r.UpdateCartItem(ctx, productID, 0, currency)
+}
+
+func (r *mutationResolver) Checkout(ctx context.Context, in *CheckoutInput, currency *string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	accountID, ok := accountIDFromContext(ctx)
+
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	if in == nil {
+		in = &CheckoutInput{}
+	}
+
+	o, err := r.server.orderClient.Checkout(ctx, accountID, stringValue(in.IdempotencyKey), in.checkout(currency))
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newOrder(*o), nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+func intValue(n *int) int {
+	if n == nil {
+		return 0
+	}
+
+	return *n
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidID = errors.New("invalid id")
+)
+
+const (
+	accountType = "Account"
+	productType = "Product"
+	orderType   = "Order"
+)
+
+// Global IDs identify a node across all services by prefixing the service's
+// own ID with the GraphQL type name.
+func toGlobalID(typename, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(typename + ":" + id))
+}
+
+func fromGlobalID(globalID string) (string, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(globalID)
+
+	if err != nil {
+		return "", "", ErrInvalidID
+	}
+
+	typename, id, ok := strings.Cut(string(b), ":")
+
+	if !ok || id == "" {
+		return "", "", ErrInvalidID
+	}
+
+	return typename, id, nil
+}
+
+// localID accepts either a global ID of the given type or a service ID, so
+// arguments keep working for clients that still send the raw IDs.
+func localID(typename, id string) string {
+	if t, local, err := fromGlobalID(id); err == nil && t == typename {
+		return local
+	}
+
+	return id
+}
+
+func (a Account) GlobalID() string {
+	return toGlobalID(accountType, a.ID)
+}
+
+func (Account) IsNode() {}
+
+func (a Account) GetID() string {
+	return a.GlobalID()
+}
+
+func (p Product) GlobalID() string {
+	return toGlobalID(productType, p.ID)
+}
+
+func (Product) IsNode() {}
+
+func (p Product) GetID() string {
+	return p.GlobalID()
+}
+
+func (o Order) GlobalID() string {
+	return toGlobalID(orderType, o.ID)
+}
+
+func (Order) IsNode() {}
+
+func (o Order) GetID() string {
+	return o.GlobalID()
+}
+
+func newPageInfo(cursors []string, nextCursor string, hasPrevious bool) *PageInfo {
+	info := &PageInfo{
+		HasNextPage:     nextCursor != "",
+		HasPreviousPage: hasPrevious,
+	}
+
+	if len(cursors) > 0 {
+		info.StartCursor = &cursors[0]
+		info.EndCursor = &cursors[len(cursors)-1]
+	}
+
+	return info
+}
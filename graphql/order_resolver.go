@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/order"
+)
+
+type orderResolver struct {
+	server *Server
+}
+
+func (r *orderResolver) Account(ctx context.Context, obj *Order) (*Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	a, err := r.server.accountClient.GetAccount(ctx, obj.AccountID)
+
+	if err != nil {
+		log.Println(err)
+
+		return nil, err
+	}
+
+	return &Account{
+		ID:   a.ID,
+		Name: a.Name,
+	}, nil
+}
+
+func newOrder(o order.Order) *Order {
+	var products []*OrderedProduct
+
+	for _, p := range o.Products {
+		product := &OrderedProduct{
+			ID:          toGlobalID(productType, p.ID),
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Currency:    p.Price.Currency,
+			TaxCategory: p.TaxCategory,
+			Tax:         p.Tax,
+			Quantity:    int(p.Quantity),
+		}
+
+		if p.ExchangeRate != "" {
+			product.ExchangeRate = &p.ExchangeRate
+		}
+
+		products = append(products, product)
+	}
+
+	discounts := []*Discount{}
+
+	for _, d := range o.Discounts {
+		discounts = append(discounts, &Discount{
+			CouponCode:  d.CouponCode,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+
+	history := []*OrderStatusChange{}
+
+	for _, c := range o.StatusHistory {
+		change := &OrderStatusChange{
+			Status:    newOrderStatus(c.Status),
+			ChangedAt: c.ChangedAt,
+			Actor:     c.Actor,
+		}
+
+		if c.Reason != "" {
+			change.Reason = &c.Reason
+		}
+
+		history = append(history, change)
+	}
+
+	refunds := []*Refund{}
+
+	for _, r := range o.Refunds {
+		refund := &Refund{
+			ID:        r.ID,
+			Reference: r.Reference,
+			Status:    RefundStatus(strings.ToUpper(string(r.Status))),
+			Amount:    r.Amount,
+			Reason:    r.Reason,
+			CreatedAt: r.CreatedAt,
+			Lines:     []*RefundLine{},
+		}
+
+		for _, l := range r.Lines {
+			refund.Lines = append(refund.Lines, &RefundLine{
+				ProductID: toGlobalID(productType, l.ProductID),
+				Quantity:  int(l.Quantity),
+				Amount:    l.Amount,
+			})
+		}
+
+		refunds = append(refunds, refund)
+	}
+
+	out := &Order{
+		ID:            o.ID,
+		AccountID:     o.AccountID,
+		CreatedAt:     o.CreatedAt,
+		Products:      products,
+		Subtotal:      o.Subtotal,
+		Discounts:     discounts,
+		Tax:           o.Tax,
+		TotalPrice:    o.TotalPrice,
+		Currency:      o.TotalPrice.Currency,
+		Status:        newOrderStatus(o.Status),
+		StatusHistory: history,
+		Refunds:       refunds,
+	}
+
+	if o.TaxRegion != "" {
+		out.TaxRegion = &o.TaxRegion
+	}
+
+	if a := o.ShippingAddress; a != nil {
+		out.ShippingAddress = &ShippingAddress{
+			Name:       a.Name,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			Region:     a.Region,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+
+		if a.ID != "" {
+			out.ShippingAddress.AddressID = &a.ID
+		}
+	}
+
+	if p := o.Payment; p != nil {
+		out.Payment = &Payment{
+			Provider:  p.Provider,
+			Reference: p.Reference,
+			Status:    PaymentStatus(strings.ToUpper(string(p.Status))),
+			Amount:    p.Amount,
+			CreatedAt: p.CreatedAt,
+			UpdatedAt: p.UpdatedAt,
+		}
+	}
+
+	return out
+}
+
+func newOrderStatus(s order.Status) OrderStatus {
+	return OrderStatus(strings.ToUpper(string(s)))
+}
+
+func newCoupon(c order.Coupon) *Coupon {
+	coupon := &Coupon{
+		Code:         c.Code,
+		Kind:         CouponKind(strings.ToUpper(string(c.Kind))),
+		Percent:      int(c.Percent),
+		BuyQuantity:  int(c.BuyQuantity),
+		FreeQuantity: int(c.FreeQuantity),
+		UsageLimit:   int(c.UsageLimit),
+	}
+
+	if !c.Amount.IsZero() {
+		coupon.Amount = &c.Amount
+	}
+
+	if !c.MinOrderValue.IsZero() {
+		coupon.MinOrderValue = &c.MinOrderValue
+	}
+
+	if c.ProductID != "" {
+		productID := toGlobalID(productType, c.ProductID)
+		coupon.ProductID = &productID
+	}
+
+	if !c.ExpiresAt.IsZero() {
+		coupon.ExpiresAt = &c.ExpiresAt
+	}
+
+	return coupon
+}
+
+func newCart(c order.Cart) *Cart {
+	cart := &Cart{
+		Items:    []*CartItem{},
+		Subtotal: c.Subtotal,
+	}
+
+	for _, i := range c.Items {
+		item := &CartItem{
+			ProductID: toGlobalID(productType, i.ProductID),
+			Quantity:  int(i.Quantity),
+			AddedAt:   i.AddedAt,
+			Available: i.Available,
+		}
+
+		// Products removed from the catalog have no details
+		if i.Name != "" {
+			name, price := i.Name, i.Price
+			item.Name = &name
+			item.Price = &price
+		}
+
+		if i.ExchangeRate != "" {
+			rate := i.ExchangeRate
+			item.ExchangeRate = &rate
+		}
+
+		cart.Items = append(cart.Items, item)
+	}
+
+	return cart
+}
@@ -3,121 +3,385 @@ package main
 import (
 	"context"
 	"log"
+	"strings"
 	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/auth"
+	"github.com/azizkhan030/go-grpc-graphql/catalog"
 )
 
 type queryResolver struct {
 	server *Server
 }
 
-func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInput, id *string) ([]*Account, error) {
+func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInput, id *string) (*AccountConnection, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 
 	defer cancel()
 
 	if id != nil {
-		r, err := r.server.accountClient.GetAccount(ctx, *id)
+		r, cursor, err := r.server.accountClient.GetAccountWithCursor(ctx, localID(accountType, *id))
 
 		if err != nil {
 			log.Println(err)
 			return nil, err
 		}
 
-		return []*Account{{
-			ID:   r.ID,
-			Name: r.Name,
-		}}, nil
+		return &AccountConnection{
+			Edges: []*AccountEdge{{
+				Cursor: cursor,
+				Node: &Account{
+					ID:   r.ID,
+					Name: r.Name,
+				},
+			}},
+			PageInfo:   newPageInfo([]string{cursor}, "", false),
+			TotalCount: 1,
+		}, nil
 	}
 
-	skip, take := uint64(0), uint64(0)
+	skip, take, cursor := uint64(0), uint64(0), ""
 
 	if pagination != nil {
-		skip, take = pagination.bounds()
+		var err error
+
+		if skip, take, err = pagination.bounds(); err != nil {
+			return nil, err
+		}
+
+		cursor = pagination.cursor()
 	}
 
-	accountList, err := r.server.accountClient.GetAccounts(ctx, skip, take)
+	page, err := r.server.accountClient.GetAccounts(ctx, skip, take, cursor)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	var accounts []*Account
-	for _, a := range accountList {
-		account := &Account{
-			ID:   a.ID,
-			Name: a.Name,
-		}
-		accounts = append(accounts, account)
+	edges := []*AccountEdge{}
+	for i, a := range page.Accounts {
+		edges = append(edges, &AccountEdge{
+			Cursor: page.Cursors[i],
+			Node: &Account{
+				ID:   a.ID,
+				Name: a.Name,
+			},
+		})
 	}
-	return accounts, nil
+
+	return &AccountConnection{
+		Edges:      edges,
+		PageInfo:   newPageInfo(page.Cursors, page.NextCursor, skip > 0 || cursor != ""),
+		TotalCount: int(page.TotalCount),
+	}, nil
 }
 
-func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string) ([]*Product, error) {
+func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string, currency *string, filter *ProductFilterInput, sort *ProductSort) (*ProductConnection, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 
 	defer cancel()
 
+	c := ""
+	if currency != nil {
+		c = *currency
+	}
+
 	if id != nil {
-		r, err := r.server.catalogClient.GetProduct(ctx, *id)
+		page, err := r.server.catalogClient.GetProducts(ctx, "", []string{localID(productType, *id)}, 0, 0, "", c)
 
 		if err != nil {
 			log.Println(err)
 			return nil, err
 		}
 
-		products := []*Product{}
-		products = append(products, &Product{
-			Name:        r.Name,
-			ID:          r.ID,
-			Description: r.Description,
-			Price:       r.Price,
+		return newProductConnection(page, false), nil
+	}
+
+	return r.server.searchProducts(ctx, productSearch(query, filter, sort), pagination, c)
+}
+
+func (r *queryResolver) ProductSuggestions(ctx context.Context, prefix string, limit *int) ([]*ProductSuggestion, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	l := 0
+	if limit != nil {
+		l = *limit
+	}
+
+	if l < 0 {
+		return nil, ErrInValidParameter
+	}
+
+	suggestions, err := r.server.catalogClient.SuggestProducts(ctx, prefix, uint32(l))
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	out := []*ProductSuggestion{}
+
+	for _, s := range suggestions {
+		out = append(out, &ProductSuggestion{
+			Text:      s.Text,
+			ProductID: toGlobalID(productType, s.ProductID),
 		})
+	}
 
-		return products, nil
+	return out, nil
+}
+
+// productSearch builds a catalog search from the arguments of a product
+// listing.
+func productSearch(query *string, filter *ProductFilterInput, sort *ProductSort) catalog.ProductSearch {
+	s := catalog.ProductSearch{}
+
+	if filter != nil {
+		s.Filter = filter.filter()
+	}
+
+	if query != nil {
+		s.Query = *query
+	}
+
+	if sort != nil {
+		s.Sort = catalog.ProductSort(strings.ToLower(sort.String()))
 	}
 
-	skip, take := uint64(0), uint64(0)
+	return s
+}
+
+func (s *Server) searchProducts(ctx context.Context, search catalog.ProductSearch, pagination *PaginationInput, currency string) (*ProductConnection, error) {
+	skip, take, cursor := uint64(0), uint64(0), ""
 
 	if pagination != nil {
-		skip, take = pagination.bounds()
+		var err error
+
+		if skip, take, err = pagination.bounds(); err != nil {
+			return nil, err
+		}
+
+		cursor = pagination.cursor()
 	}
 
-	q := ""
-	if query != nil {
-		q = *query
+	page, err := s.catalogClient.SearchProducts(ctx, search, take, skip, cursor, currency)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
 	}
 
-	productList, err := r.server.catalogClient.GetProducts(ctx, q, nil, take, skip)
+	return newProductConnection(page, skip > 0 || cursor != ""), nil
+}
+
+func newProductConnection(page *catalog.ProductPage, hasPrevious bool) *ProductConnection {
+	edges := []*ProductEdge{}
+	for i, a := range page.Products {
+		edges = append(edges, &ProductEdge{
+			Cursor: page.Cursors[i],
+			Node:   newProduct(a),
+		})
+	}
+
+	return &ProductConnection{
+		Edges:      edges,
+		PageInfo:   newPageInfo(page.Cursors, page.NextCursor, hasPrevious),
+		TotalCount: int(page.TotalCount),
+		Facets:     newFacets(page.Facets),
+	}
+}
+
+func (r *queryResolver) Categories(ctx context.Context, parent *string) ([]*catalog.Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	p := ""
+	if parent != nil {
+		p = *parent
+	}
+
+	return r.server.categories(ctx, p)
+}
+
+func (r *queryResolver) Category(ctx context.Context, slug string) (*catalog.Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	c, err := r.server.catalogClient.GetCategory(ctx, slug)
 
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	var products []*Product
-	for _, a := range productList {
-		products = append(products,
-			&Product{
-				ID:          a.ID,
-				Name:        a.Name,
-				Description: a.Description,
-				Price:       a.Price,
-			})
+	return c, nil
+}
+
+func (in ProductFilterInput) filter() catalog.ProductFilter {
+	f := catalog.ProductFilter{Categories: in.Categories}
+
+	if in.MinPrice != nil {
+		f.MinPrice = *in.MinPrice
+	}
+
+	if in.MaxPrice != nil {
+		f.MaxPrice = *in.MaxPrice
+	}
+
+	if in.InStock != nil {
+		f.InStock = *in.InStock
 	}
-	return products, nil
+
+	return f
 }
 
-func (p PaginationInput) bounds() (uint64, uint64) {
+func (r *queryResolver) Order(ctx context.Context, id string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	o, err := r.server.orderClient.GetOrder(ctx, localID(orderType, id))
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newOrder(*o), nil
+}
+
+func (r *queryResolver) PreviewOrder(ctx context.Context, in OrderInput, currency *string) (*OrderPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	accountID, products, err := orderRequest(ctx, in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := r.server.orderClient.PreviewOrder(ctx, accountID, in.checkout(currency), products)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	preview := newOrder(*o)
+
+	return &OrderPreview{
+		Products:        preview.Products,
+		Subtotal:        preview.Subtotal,
+		Discounts:       preview.Discounts,
+		Tax:             preview.Tax,
+		TotalPrice:      preview.TotalPrice,
+		Currency:        preview.Currency,
+		TaxRegion:       preview.TaxRegion,
+		ShippingAddress: preview.ShippingAddress,
+	}, nil
+}
+
+func (r *queryResolver) Cart(ctx context.Context, currency *string) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	accountID, ok := accountIDFromContext(ctx)
+
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	c, err := r.server.orderClient.GetCart(ctx, accountID, stringValue(currency))
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return newCart(*c), nil
+}
+
+func (r *queryResolver) Node(ctx context.Context, id string) (Node, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	defer cancel()
+
+	typename, local, err := fromGlobalID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch typename {
+	case accountType:
+		if !auth.CanActFor(ctx, local) {
+			return nil, auth.ErrForbidden
+		}
+
+		a, err := r.server.accountClient.GetAccount(ctx, local)
+
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		return &Account{
+			ID:   a.ID,
+			Name: a.Name,
+		}, nil
+	case productType:
+		p, err := r.server.catalogClient.GetProduct(ctx, local, "")
+
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		return newProduct(*p), nil
+	case orderType:
+		o, err := r.server.orderClient.GetOrder(ctx, local)
+
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		return newOrder(*o), nil
+	}
+
+	return nil, ErrInvalidID
+}
+
+// bounds fails with ErrInValidParameter if skip or take is negative.
+func (p PaginationInput) bounds() (uint64, uint64, error) {
 	skipValue := uint64(0)
 	takeValue := uint64(0)
 
+	if (p.Skip != nil && *p.Skip < 0) || (p.Take != nil && *p.Take < 0) {
+		return 0, 0, ErrInValidParameter
+	}
+
 	if p.Skip != nil {
 		skipValue = uint64(*p.Skip)
 	}
 
 	if p.Take != nil {
-		takeValue = uint64(*p.Skip)
+		takeValue = uint64(*p.Take)
+	}
+
+	return skipValue, takeValue, nil
+}
+
+func (p PaginationInput) cursor() string {
+	if p.Cursor == nil {
+		return ""
 	}
 
-	return skipValue, takeValue
+	return *p.Cursor
 }
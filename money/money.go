@@ -0,0 +1,186 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+	ErrInvalidAmount    = errors.New("money: invalid amount")
+	ErrInvalidCurrency  = errors.New("money: invalid currency")
+	ErrOverflow         = errors.New("money: amount out of range")
+)
+
+// Money is an exact amount in the minor units of a currency, e.g. 1999 USD
+// is $19.99. The zero value is zero in no particular currency and can be
+// added to an amount in any currency.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// exponents lists the currencies that don't have two decimal places.
+var exponents = map[string]int{
+	"BHD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"VND": 0,
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 currency code.
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Exponent returns the number of decimal places of the currency.
+func Exponent(currency string) int {
+	if e, ok := exponents[currency]; ok {
+		return e
+	}
+
+	return 2
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	currency, err := commonCurrency(m, o)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) || (o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: m.Amount + o.Amount, Currency: currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	currency, err := commonCurrency(m, o)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	if (o.Amount < 0 && m.Amount > math.MaxInt64+o.Amount) || (o.Amount > 0 && m.Amount < math.MinInt64+o.Amount) {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: m.Amount - o.Amount, Currency: currency}, nil
+}
+
+// Mul multiplies the amount by n, failing with ErrOverflow if the product
+// doesn't fit.
+func (m Money) Mul(n int64) (Money, error) {
+	product := m.Amount * n
+
+	if n != 0 && (product/n != m.Amount || (n == -1 && m.Amount == math.MinInt64)) {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+func commonCurrency(a, b Money) (string, error) {
+	switch {
+	case a.Currency == b.Currency:
+		return a.Currency, nil
+	case a == Money{}:
+		return b.Currency, nil
+	case b == Money{}:
+		return a.Currency, nil
+	}
+
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.Currency, b.Currency)
+}
+
+// String formats the amount in major units followed by the currency code,
+// e.g. "19.99 USD".
+func (m Money) String() string {
+	exp := Exponent(m.Currency)
+	// Unsigned, since the most negative amount has no positive counterpart
+	amount := uint64(m.Amount)
+	sign := ""
+
+	if m.Amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	s := strconv.FormatUint(amount, 10)
+
+	if exp > 0 {
+		if len(s) <= exp {
+			s = strings.Repeat("0", exp-len(s)+1) + s
+		}
+
+		s = s[:len(s)-exp] + "." + s[len(s)-exp:]
+	}
+
+	return strings.TrimSpace(sign + s + " " + m.Currency)
+}
+
+// Parse reads an amount formatted like String, e.g. "19.99 USD". The amount
+// can't have more decimal places than the currency.
+func Parse(s string) (Money, error) {
+	fields := strings.Fields(s)
+
+	if len(fields) != 2 {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	currency := fields[1]
+
+	if !ValidCurrency(currency) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+	}
+
+	amount := fields[0]
+	exp := Exponent(currency)
+
+	if whole, frac, ok := strings.Cut(amount, "."); ok {
+		if frac == "" || len(frac) > exp {
+			return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+		}
+
+		amount = whole + frac + strings.Repeat("0", exp-len(frac))
+	} else {
+		amount += strings.Repeat("0", exp)
+	}
+
+	minor, err := strconv.ParseInt(amount, 10, 64)
+
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
@@ -0,0 +1,187 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func() (Money, error)
+		want    Money
+		wantErr error
+	}{
+		{
+			name: "add",
+			op:   func() (Money, error) { return New(1999, "USD").Add(New(1, "USD")) },
+			want: New(2000, "USD"),
+		},
+		{
+			name: "add to zero value",
+			op:   func() (Money, error) { return Money{}.Add(New(5, "EUR")) },
+			want: New(5, "EUR"),
+		},
+		{
+			name: "add up to the limit",
+			op:   func() (Money, error) { return New(math.MaxInt64-1, "USD").Add(New(1, "USD")) },
+			want: New(math.MaxInt64, "USD"),
+		},
+		{
+			name:    "add over the limit",
+			op:      func() (Money, error) { return New(math.MaxInt64, "USD").Add(New(1, "USD")) },
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "add under the limit",
+			op:      func() (Money, error) { return New(math.MinInt64, "USD").Add(New(-1, "USD")) },
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "add other currency",
+			op:      func() (Money, error) { return New(1, "USD").Add(New(1, "EUR")) },
+			wantErr: ErrCurrencyMismatch,
+		},
+		{
+			name: "subtract down to the limit",
+			op:   func() (Money, error) { return New(-1, "USD").Sub(New(math.MaxInt64, "USD")) },
+			want: New(math.MinInt64, "USD"),
+		},
+		{
+			name:    "subtract under the limit",
+			op:      func() (Money, error) { return New(math.MinInt64, "USD").Sub(New(1, "USD")) },
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "subtract a negative over the limit",
+			op:      func() (Money, error) { return New(math.MaxInt64, "USD").Sub(New(-1, "USD")) },
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "negate the most negative amount",
+			op:      func() (Money, error) { return New(0, "USD").Sub(New(math.MinInt64, "USD")) },
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "subtract other currency",
+			op:      func() (Money, error) { return New(1, "USD").Sub(New(1, "EUR")) },
+			wantErr: ErrCurrencyMismatch,
+		},
+		{
+			name: "multiply",
+			op:   func() (Money, error) { return New(1999, "USD").Mul(3) },
+			want: New(5997, "USD"),
+		},
+		{
+			name: "multiply by zero",
+			op:   func() (Money, error) { return New(math.MaxInt64, "USD").Mul(0) },
+			want: New(0, "USD"),
+		},
+		{
+			name: "multiply down to the limit",
+			op:   func() (Money, error) { return New(-1<<62, "USD").Mul(2) },
+			want: New(math.MinInt64, "USD"),
+		},
+		{
+			name:    "multiply over the limit",
+			op:      func() (Money, error) { return New(1<<62, "USD").Mul(2) },
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "multiply wrapping around to a positive",
+			op:      func() (Money, error) { return New(math.MaxInt64, "USD").Mul(math.MaxInt64) },
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "negate the most negative amount by multiplying",
+			op:      func() (Money, error) { return New(math.MinInt64, "USD").Mul(-1) },
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "multiply -1 by the most negative factor",
+			op:      func() (Money, error) { return New(-1, "USD").Mul(math.MinInt64) },
+			wantErr: ErrOverflow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op()
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringParse(t *testing.T) {
+	tests := []struct {
+		money Money
+		s     string
+	}{
+		{money: New(1999, "USD"), s: "19.99 USD"},
+		{money: New(5, "USD"), s: "0.05 USD"},
+		{money: New(-5, "USD"), s: "-0.05 USD"},
+		{money: New(0, "USD"), s: "0.00 USD"},
+		{money: New(1999, "JPY"), s: "1999 JPY"},
+		{money: New(-3, "JPY"), s: "-3 JPY"},
+		{money: New(1234, "KWD"), s: "1.234 KWD"},
+		{money: New(5, "BHD"), s: "0.005 BHD"},
+		{money: New(-1000, "BHD"), s: "-1.000 BHD"},
+		{money: New(math.MaxInt64, "USD"), s: "92233720368547758.07 USD"},
+		{money: New(math.MinInt64, "USD"), s: "-92233720368547758.08 USD"},
+		{money: New(math.MinInt64, "JPY"), s: "-9223372036854775808 JPY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := tt.money.String(); got != tt.s {
+				t.Errorf("String() = %q, want %q", got, tt.s)
+			}
+
+			got, err := Parse(tt.s)
+
+			if err != nil || got != tt.money {
+				t.Errorf("Parse(%q) = %+v, %v, want %+v", tt.s, got, err, tt.money)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Money
+		wantErr error
+	}{
+		{s: "19 USD", want: New(1900, "USD")},
+		{s: "19.9 USD", want: New(1990, "USD")},
+		{s: "1.5 KWD", want: New(1500, "KWD")},
+		{s: "1.999 USD", wantErr: ErrInvalidAmount},
+		{s: "1.5 JPY", wantErr: ErrInvalidAmount},
+		{s: "1. USD", wantErr: ErrInvalidAmount},
+		{s: "92233720368547758.08 USD", wantErr: ErrInvalidAmount},
+		{s: "USD", wantErr: ErrInvalidAmount},
+		{s: "1.00 usd", wantErr: ErrInvalidCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := Parse(tt.s)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q) error = %v, want %v", tt.s, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
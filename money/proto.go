@@ -0,0 +1,18 @@
+package money
+
+import (
+	pb "github.com/azizkhan030/go-grpc-graphql/money/protos/gen"
+)
+
+func (m Money) Proto() *pb.Money {
+	return &pb.Money{Amount: m.Amount, Currency: m.Currency}
+}
+
+// FromProto converts a proto message, which may be nil, to Money.
+func FromProto(p *pb.Money) Money {
+	if p == nil {
+		return Money{}
+	}
+
+	return Money{Amount: p.Amount, Currency: p.Currency}
+}
@@ -0,0 +1,115 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+var (
+	ErrInvalidRate = errors.New("money: invalid exchange rate")
+)
+
+// Rate converts amounts from one currency to another. Value is the amount of
+// To that one unit of From buys, as an exact decimal string like "0.9213".
+type Rate struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"rate"`
+}
+
+func ParseRate(from, to, value string) (Rate, error) {
+	if !ValidCurrency(from) || !ValidCurrency(to) || from == to {
+		return Rate{}, fmt.Errorf("%w: %s to %s", ErrInvalidRate, from, to)
+	}
+
+	if _, err := ratValue(value); err != nil {
+		return Rate{}, err
+	}
+
+	return Rate{From: from, To: to, Value: value}, nil
+}
+
+// decimalPattern matches plain decimals, which is all rates are stored as.
+// big.Rat also reads fractions and exponents, e.g. "1/3" and "1e3".
+var decimalPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+func ratValue(value string) (*big.Rat, error) {
+	if !decimalPattern.MatchString(value) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRate, value)
+	}
+
+	v, ok := new(big.Rat).SetString(value)
+
+	if !ok || v.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRate, value)
+	}
+
+	return v, nil
+}
+
+// Convert converts m into the target currency of the rate, rounding half
+// away from zero to the minor unit of that currency.
+func (m Money) Convert(r Rate) (Money, error) {
+	if m.Currency != r.From {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, r.From)
+	}
+
+	v, err := ratValue(r.Value)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	x := new(big.Rat).SetInt64(m.Amount)
+	x.Mul(x, v)
+
+	// Rescale from the minor units of one currency to those of the other
+	shift := Exponent(r.To) - Exponent(m.Currency)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+
+	if shift >= 0 {
+		x.Mul(x, scale)
+	} else {
+		x.Quo(x, scale)
+	}
+
+	amount, err := roundHalfAway(x)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: amount, Currency: r.To}, nil
+}
+
+// roundHalfAway fails with ErrOverflow if the rounded value doesn't fit in
+// an int64.
+func roundHalfAway(x *big.Rat) (int64, error) {
+	num := new(big.Int).Abs(x.Num())
+	q, rem := new(big.Int).QuoRem(num, x.Denom(), new(big.Int))
+
+	// Round up when the remainder is at least half the denominator
+	if rem.Mul(rem, big.NewInt(2)).Cmp(x.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("%w: %s", ErrOverflow, q)
+	}
+
+	return q.Int64(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,129 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		from, to, value string
+		wantErr         error
+	}{
+		{from: "USD", to: "EUR", value: "0.9213"},
+		{from: "USD", to: "JPY", value: "150"},
+		{from: "USD", to: "EUR", value: "1/3", wantErr: ErrInvalidRate},
+		{from: "USD", to: "EUR", value: "1e3", wantErr: ErrInvalidRate},
+		{from: "USD", to: "EUR", value: "-1", wantErr: ErrInvalidRate},
+		{from: "USD", to: "EUR", value: "0", wantErr: ErrInvalidRate},
+		{from: "USD", to: "EUR", value: ".5", wantErr: ErrInvalidRate},
+		{from: "USD", to: "USD", value: "1", wantErr: ErrInvalidRate},
+		{from: "usd", to: "EUR", value: "1", wantErr: ErrInvalidRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"/"+tt.to+"="+tt.value, func(t *testing.T) {
+			if _, err := ParseRate(tt.from, tt.to, tt.value); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseRate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		money   Money
+		rate    Rate
+		want    Money
+		wantErr error
+	}{
+		{
+			name:  "same exponent",
+			money: New(1999, "USD"),
+			rate:  Rate{From: "USD", To: "EUR", Value: "0.9213"},
+			want:  New(1842, "EUR"),
+		},
+		{
+			name:  "half rounds up",
+			money: New(1, "USD"),
+			rate:  Rate{From: "USD", To: "EUR", Value: "0.5"},
+			want:  New(1, "EUR"),
+		},
+		{
+			name:  "negative half rounds down",
+			money: New(-1, "USD"),
+			rate:  Rate{From: "USD", To: "EUR", Value: "0.5"},
+			want:  New(-1, "EUR"),
+		},
+		{
+			name:  "negative odd half rounds down",
+			money: New(-3, "USD"),
+			rate:  Rate{From: "USD", To: "EUR", Value: "0.5"},
+			want:  New(-2, "EUR"),
+		},
+		{
+			name:  "negative below half rounds towards zero",
+			money: New(-1, "USD"),
+			rate:  Rate{From: "USD", To: "EUR", Value: "0.4"},
+			want:  New(0, "EUR"),
+		},
+		{
+			name:  "negative into fewer decimals",
+			money: New(-1005, "USD"),
+			rate:  Rate{From: "USD", To: "JPY", Value: "150"},
+			want:  New(-1508, "JPY"),
+		},
+		{
+			name:  "into more decimals",
+			money: New(1, "JPY"),
+			rate:  Rate{From: "JPY", To: "KWD", Value: "0.0021"},
+			want:  New(2, "KWD"),
+		},
+		{
+			name:  "negative half into more decimals",
+			money: New(-1, "JPY"),
+			rate:  Rate{From: "JPY", To: "KWD", Value: "0.0025"},
+			want:  New(-3, "KWD"),
+		},
+		{
+			name:    "over the limit",
+			money:   New(math.MaxInt64, "USD"),
+			rate:    Rate{From: "USD", To: "EUR", Value: "2"},
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "under the limit into more decimals",
+			money:   New(math.MinInt64, "JPY"),
+			rate:    Rate{From: "JPY", To: "USD", Value: "1"},
+			wantErr: ErrOverflow,
+		},
+		{
+			name:    "other currency",
+			money:   New(1, "EUR"),
+			rate:    Rate{From: "USD", To: "JPY", Value: "150"},
+			wantErr: ErrCurrencyMismatch,
+		},
+		{
+			name:    "fraction",
+			money:   New(1, "USD"),
+			rate:    Rate{From: "USD", To: "EUR", Value: "1/3"},
+			wantErr: ErrInvalidRate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.money.Convert(tt.rate)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Convert() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Convert() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
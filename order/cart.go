@@ -0,0 +1,59 @@
+package order
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+var (
+	ErrCartEmpty = errors.New("cart is empty")
+	ErrCartFull  = errors.New("cart has too many items")
+)
+
+// maxCartItems bounds the number of distinct products in a cart.
+const maxCartItems = 100
+
+// Cart holds the products an account is about to order, one item per
+// product. Subtotal is the total of the available items.
+type Cart struct {
+	AccountID string
+	Items     []CartItem
+	Subtotal  money.Money
+}
+
+// CartItem is a product in a cart. Only ProductID, Quantity and AddedAt are
+// stored, the rest is looked up in the catalog whenever the cart is read.
+// An item isn't Available if its product was removed from the catalog or
+// doesn't have enough stock left.
+type CartItem struct {
+	ProductID    string
+	Quantity     uint32
+	AddedAt      time.Time
+	Name         string
+	Price        money.Money
+	ExchangeRate string
+	Available    bool
+}
+
+func (c Cart) quantity(productID string) uint32 {
+	for _, item := range c.Items {
+		if item.ProductID == productID {
+			return item.Quantity
+		}
+	}
+
+	return 0
+}
+
+// addQuantities adds up quantities of a product, capped at the largest
+// quantity rather than wrapping around. A capped quantity is never in stock.
+func addQuantities(a, b uint32) uint32 {
+	if b > math.MaxUint32-a {
+		return math.MaxUint32
+	}
+
+	return a + b
+}
@@ -5,6 +5,9 @@ import (
 	"log"
 	"time"
 
+	"github.com/azizkhan030/go-grpc-graphql/account"
+	"github.com/azizkhan030/go-grpc-graphql/auth"
+	"github.com/azizkhan030/go-grpc-graphql/money"
 	pb "github.com/azizkhan030/go-grpc-graphql/order/protos/gen"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -16,7 +19,10 @@ type Client struct {
 }
 
 func NewClient(url string) (*Client, error) {
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(auth.UnaryClientInterceptor()),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -29,7 +35,64 @@ func (c *Client) Close() {
 	c.conn.Close()
 }
 
-func (c *Client) PostOrder(ctx context.Context, accountId string, products []OrderedProduct) (*Order, error) {
+// PostOrder places an order. A shipping address with an ID refers to a saved
+// address of the account, other addresses are sent as they are.
+func (c *Client) PostOrder(ctx context.Context, accountId, idempotencyKey string, checkout Checkout, products []OrderedProduct) (*Order, error) {
+	req := &pb.PostOrderRequest{
+		AccountId:      accountId,
+		Products:       requestProducts(products),
+		IdempotencyKey: idempotencyKey,
+		Currency:       checkout.Currency,
+		CouponCode:     checkout.CouponCode,
+		Region:         checkout.Region,
+	}
+	req.AddressId, req.ShippingAddress = requestAddress(checkout.ShippingAddress)
+
+	r, err := c.service.PostOrder(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	newOrder := orderFromProto(r.Order)
+
+	return &newOrder, nil
+}
+
+// PreviewOrder prices an order like PostOrder would, without placing it.
+func (c *Client) PreviewOrder(ctx context.Context, accountId string, checkout Checkout, products []OrderedProduct) (*Order, error) {
+	req := &pb.PreviewOrderRequest{
+		AccountId:  accountId,
+		Products:   requestProducts(products),
+		Currency:   checkout.Currency,
+		CouponCode: checkout.CouponCode,
+		Region:     checkout.Region,
+	}
+	req.AddressId, req.ShippingAddress = requestAddress(checkout.ShippingAddress)
+
+	r, err := c.service.PreviewOrder(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+
+	return &o, nil
+}
+
+func requestAddress(a *account.Address) (string, *pb.Order_ShippingAddress) {
+	switch {
+	case a == nil:
+		return "", nil
+	case a.ID != "":
+		return a.ID, nil
+	}
+
+	return "", addressOut(*a)
+}
+
+func requestProducts(products []OrderedProduct) []*pb.PostOrderRequest_OrderProduct {
 	protoProducts := []*pb.PostOrderRequest_OrderProduct{}
 
 	for _, p := range products {
@@ -38,34 +101,57 @@ func (c *Client) PostOrder(ctx context.Context, accountId string, products []Ord
 			Quantity:  p.Quantity,
 		})
 	}
-	r, err := c.service.PostOrder(
-		ctx,
-		&pb.PostOrderRequest{
-			AccountId: accountId,
-			Products:  protoProducts,
-		},
-	)
+
+	return protoProducts
+}
+
+func (c *Client) CreateCoupon(ctx context.Context, coupon Coupon) (*Coupon, error) {
+	r, err := c.service.CreateCoupon(ctx, &pb.CreateCouponRequest{
+		Coupon: coupon.Proto(),
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	newOrder := r.Order
-	newOrderCreatedAt := time.Time{}
-	newOrderCreatedAt.UnmarshalBinary(newOrder.CreatedAt)
+	created := CouponFromProto(r.Coupon)
 
-	return &Order{
-		ID:         newOrder.Id,
-		CreatedAt:  newOrderCreatedAt,
-		TotalPrice: newOrder.TotalPrice,
-		Products:   products,
-		AccountID:  newOrder.AccountId,
-	}, nil
+	return &created, nil
 }
 
-func (c *Client) GetOrdersForAccount(ctx context.Context, accountId string) ([]Order, error) {
+func (c *Client) GetOrder(ctx context.Context, id string) (*Order, error) {
+	r, err := c.service.GetOrder(ctx, &pb.GetOrderRequest{Id: id})
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+
+	return &o, nil
+}
+
+func (c *Client) TransitionOrder(ctx context.Context, id string, status Status) (*Order, error) {
+	r, err := c.service.TransitionOrder(ctx, &pb.TransitionOrderRequest{
+		Id:     id,
+		Status: string(status),
+	})
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+
+	return &o, nil
+}
+
+func (c *Client) GetOrdersForAccount(ctx context.Context, accountId string, f OrderFilter) (*OrderPage, error) {
 	r, err := c.service.GetOrdersForAccount(ctx, &pb.GetOrderForAccountRequest{
 		AccountId: accountId,
+		Filter:    filterOut(f),
 	})
 
 	if err != nil {
@@ -76,27 +162,275 @@ func (c *Client) GetOrdersForAccount(ctx context.Context, accountId string) ([]O
 	orders := []Order{}
 
 	for _, orderProto := range r.Orders {
-		newOrder := Order{
-			ID:         orderProto.Id,
-			TotalPrice: orderProto.TotalPrice,
-			AccountID:  orderProto.AccountId,
+		orders = append(orders, orderFromProto(orderProto))
+	}
+
+	return &OrderPage{
+		Orders:     orders,
+		Cursors:    r.Cursors,
+		NextCursor: r.NextCursor,
+		TotalCount: r.TotalCount,
+	}, nil
+}
+
+// GetOrdersForAccounts fetches a page of orders of several accounts in one
+// call, keyed by account ID.
+func (c *Client) GetOrdersForAccounts(ctx context.Context, accountIDs []string, f OrderFilter) (map[string]*OrderPage, error) {
+	r, err := c.service.GetOrdersForAccounts(ctx, &pb.GetOrdersForAccountsRequest{
+		AccountIds: accountIDs,
+		Filter:     filterOut(f),
+	})
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	pages := map[string]*OrderPage{}
+
+	for _, a := range r.Accounts {
+		page := &OrderPage{
+			Orders:     []Order{},
+			Cursors:    a.Cursors,
+			NextCursor: a.NextCursor,
+			TotalCount: a.TotalCount,
+		}
+
+		for _, orderProto := range a.Orders {
+			page.Orders = append(page.Orders, orderFromProto(orderProto))
+		}
+
+		pages[a.AccountId] = page
+	}
+
+	return pages, nil
+}
+
+func orderFromProto(orderProto *pb.Order) Order {
+	newOrder := Order{
+		ID:         orderProto.Id,
+		Subtotal:   money.FromProto(orderProto.Subtotal),
+		Tax:        money.FromProto(orderProto.Tax),
+		TotalPrice: money.FromProto(orderProto.TotalPrice),
+		TaxRegion:  orderProto.TaxRegion,
+		AccountID:  orderProto.AccountId,
+		Status:     Status(orderProto.Status),
+	}
+	newOrder.CreatedAt = time.Time{}
+	newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
+
+	if p := orderProto.Payment; p != nil {
+		newOrder.Payment = &Payment{
+			OrderID:   newOrder.ID,
+			Provider:  p.Provider,
+			Reference: p.Reference,
+			Status:    PaymentStatus(p.Status),
+			Amount:    money.FromProto(p.Amount),
+		}
+		newOrder.Payment.CreatedAt.UnmarshalBinary(p.CreatedAt)
+		newOrder.Payment.UpdatedAt.UnmarshalBinary(p.UpdatedAt)
+	}
+
+	if orderProto.ShippingAddress != nil {
+		a := addressIn(orderProto.ShippingAddress)
+		a.AccountID = newOrder.AccountID
+		newOrder.ShippingAddress = &a
+	}
+
+	for _, r := range orderProto.Refunds {
+		refund := Refund{
+			ID:        r.Id,
+			OrderID:   newOrder.ID,
+			Reference: r.Reference,
+			Status:    RefundStatus(r.Status),
+			Amount:    money.FromProto(r.Amount),
+			Reason:    r.Reason,
+			Actor:     r.Actor,
 		}
-		newOrder.CreatedAt = time.Time{}
-		newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
-		products := []OrderedProduct{}
-
-		for _, productProto := range orderProto.Products {
-			products = append(products, OrderedProduct{
-				ID:          productProto.Id,
-				Quantity:    productProto.Quantity,
-				Name:        productProto.Name,
-				Description: productProto.Description,
-				Price:       productProto.Price,
+		refund.CreatedAt.UnmarshalBinary(r.CreatedAt)
+
+		for _, l := range r.Lines {
+			refund.Lines = append(refund.Lines, RefundLine{
+				ProductID: l.ProductId,
+				Quantity:  l.Quantity,
+				Amount:    money.FromProto(l.Amount),
 			})
 		}
-		newOrder.Products = products
-		orders = append(orders, newOrder)
+
+		newOrder.Refunds = append(newOrder.Refunds, refund)
+	}
+
+	for _, d := range orderProto.Discounts {
+		newOrder.Discounts = append(newOrder.Discounts, Discount{
+			CouponCode:  d.CouponCode,
+			Description: d.Description,
+			Amount:      money.FromProto(d.Amount),
+		})
+	}
+
+	for _, c := range orderProto.StatusHistory {
+		change := StatusChange{
+			Status: Status(c.Status),
+			Actor:  c.Actor,
+			Reason: c.Reason,
+		}
+		change.ChangedAt.UnmarshalBinary(c.ChangedAt)
+		newOrder.StatusHistory = append(newOrder.StatusHistory, change)
+	}
+	products := []OrderedProduct{}
+
+	for _, productProto := range orderProto.Products {
+		products = append(products, OrderedProduct{
+			ID:           productProto.Id,
+			Quantity:     productProto.Quantity,
+			Name:         productProto.Name,
+			Description:  productProto.Description,
+			Price:        money.FromProto(productProto.Price),
+			ExchangeRate: productProto.ExchangeRate,
+			TaxCategory:  productProto.TaxCategory,
+			Tax:          money.FromProto(productProto.Tax),
+		})
+	}
+	newOrder.Products = products
+
+	return newOrder
+}
+
+// PayOrder charges the order's total to the payment method the token stands
+// for.
+func (c *Client) PayOrder(ctx context.Context, id, paymentToken string) (*Order, error) {
+	r, err := c.service.PayOrder(ctx, &pb.PayOrderRequest{Id: id, PaymentToken: paymentToken})
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+
+	return &o, nil
+}
+
+func (c *Client) CancelOrder(ctx context.Context, id, reason string) (*Order, error) {
+	r, err := c.service.CancelOrder(ctx, &pb.CancelOrderRequest{Id: id, Reason: reason})
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+
+	return &o, nil
+}
+
+// RefundOrderLines refunds the given quantities of the order's lines. Only
+// ProductID and Quantity of the lines are used.
+func (c *Client) RefundOrderLines(ctx context.Context, id string, lines []RefundLine, reason string) (*Order, error) {
+	in := []*pb.RefundOrderLinesRequest_Line{}
+
+	for _, l := range lines {
+		in = append(in, &pb.RefundOrderLinesRequest_Line{ProductId: l.ProductID, Quantity: l.Quantity})
+	}
+
+	r, err := c.service.RefundOrderLines(ctx, &pb.RefundOrderLinesRequest{Id: id, Lines: in, Reason: reason})
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+
+	return &o, nil
+}
+
+func (c *Client) GetCart(ctx context.Context, accountId, currency string) (*Cart, error) {
+	r, err := c.service.GetCart(ctx, &pb.GetCartRequest{AccountId: accountId, Currency: currency})
+
+	if err != nil {
+		return nil, err
+	}
+
+	cart := cartFromProto(r.Cart)
+
+	return &cart, nil
+}
+
+// AddToCart adds quantity units of the product to the cart.
+func (c *Client) AddToCart(ctx context.Context, accountId, productId string, quantity uint32, currency string) (*Cart, error) {
+	r, err := c.service.AddToCart(ctx, &pb.AddToCartRequest{
+		AccountId: accountId,
+		ProductId: productId,
+		Quantity:  quantity,
+		Currency:  currency,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	cart := cartFromProto(r.Cart)
+
+	return &cart, nil
+}
+
+// UpdateCartItem replaces the quantity of the product in the cart. A zero
+// quantity removes it.
+func (c *Client) UpdateCartItem(ctx context.Context, accountId, productId string, quantity uint32, currency string) (*Cart, error) {
+	r, err := c.service.UpdateCartItem(ctx, &pb.UpdateCartItemRequest{
+		AccountId: accountId,
+		ProductId: productId,
+		Quantity:  quantity,
+		Currency:  currency,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	cart := cartFromProto(r.Cart)
+
+	return &cart, nil
+}
+
+// Checkout places an order for the items in the account's cart.
+func (c *Client) Checkout(ctx context.Context, accountId, idempotencyKey string, checkout Checkout) (*Order, error) {
+	req := &pb.CheckoutRequest{
+		AccountId:      accountId,
+		IdempotencyKey: idempotencyKey,
+		Currency:       checkout.Currency,
+		CouponCode:     checkout.CouponCode,
+		Region:         checkout.Region,
+	}
+	req.AddressId, req.ShippingAddress = requestAddress(checkout.ShippingAddress)
+
+	r, err := c.service.Checkout(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+
+	return &o, nil
+}
+
+func cartFromProto(p *pb.Cart) Cart {
+	cart := Cart{
+		AccountID: p.AccountId,
+		Subtotal:  money.FromProto(p.Subtotal),
+	}
+
+	for _, i := range p.Items {
+		item := CartItem{
+			ProductID:    i.ProductId,
+			Quantity:     i.Quantity,
+			Name:         i.Name,
+			Price:        money.FromProto(i.Price),
+			ExchangeRate: i.ExchangeRate,
+			Available:    i.Available,
+		}
+		item.AddedAt.UnmarshalBinary(i.AddedAt)
+		cart.Items = append(cart.Items, item)
 	}
 
-	return orders, nil
+	return cart
 }
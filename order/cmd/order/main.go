@@ -4,6 +4,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	"github.com/azizkhan030/go-grpc-graphql/order"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
@@ -13,6 +14,14 @@ type Config struct {
 	DatabaseURL string `envconfig:"DATABASE_URL"`
 	AccountURL  string `envconfig:"ACCOUNT_SERVICE_URL"`
 	CatalogURL  string `envconfig:"CATALOG_SERVICE_URL"`
+	JWTSecret   string `envconfig:"JWT_SECRET" required:"true"`
+	TaxRules    string `envconfig:"TAX_RULES"`
+	// DefaultTaxRegion taxes orders without a region, TaxStrict rejects orders
+	// the tax rules don't cover instead of placing them untaxed
+	DefaultTaxRegion string `envconfig:"TAX_DEFAULT_REGION"`
+	TaxStrict        bool   `envconfig:"TAX_STRICT"`
+	// PaymentProvider names the payment provider, only "fake" exists so far
+	PaymentProvider string `envconfig:"PAYMENT_PROVIDER" default:"fake"`
 }
 
 func main() {
@@ -24,6 +33,25 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err = auth.CheckSecret(cfg.JWTSecret); err != nil {
+		log.Fatal(err)
+	}
+
+	rules, err := order.ParseTaxRules(cfg.TaxRules)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var payments order.PaymentProvider
+
+	switch cfg.PaymentProvider {
+	case "fake":
+		payments = order.NewFakePaymentProvider()
+	default:
+		log.Fatalf("unknown payment provider %q", cfg.PaymentProvider)
+	}
+
 	var r order.Repository
 
 	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
@@ -39,7 +67,7 @@ func main() {
 	defer r.Close()
 
 	log.Println("Listening for port 8080 ...")
-	s := order.NewService(r)
+	s := order.NewService(r, order.NewRuleTable(rules), order.TaxPolicy{DefaultRegion: cfg.DefaultTaxRegion, Strict: cfg.TaxStrict}, payments)
 
-	log.Fatal(order.ListenGRPC(s, cfg.AccountURL, cfg.CatalogURL, 8080))
+	log.Fatal(order.ListenGRPC(s, auth.NewTokenIssuer(cfg.JWTSecret, 0), cfg.AccountURL, cfg.CatalogURL, 8080))
 }
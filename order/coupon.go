@@ -0,0 +1,199 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+	pb "github.com/azizkhan030/go-grpc-graphql/order/protos/gen"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponUsageLimit    = errors.New("coupon usage limit reached")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this order")
+	ErrInvalidCoupon       = errors.New("invalid coupon")
+)
+
+type CouponKind string
+
+const (
+	CouponPercentage CouponKind = "percentage"
+	CouponFixed      CouponKind = "fixed"
+	CouponBuyXGetY   CouponKind = "buy_x_get_y"
+)
+
+// Coupon is a promotion customers can apply to an order by its code. Which
+// fields are used depends on the kind: Percent for percentage coupons,
+// Amount for fixed ones and ProductID, BuyQuantity and FreeQuantity for
+// buy-X-get-Y ones. A zero MinOrderValue, UsageLimit or ExpiresAt means no
+// limit.
+type Coupon struct {
+	Code          string
+	Kind          CouponKind
+	Percent       uint32
+	Amount        money.Money
+	ProductID     string
+	BuyQuantity   uint32
+	FreeQuantity  uint32
+	MinOrderValue money.Money
+	UsageLimit    uint32
+	ExpiresAt     time.Time
+}
+
+// Discount is a discount line of an order. Amount is subtracted from the
+// order's subtotal.
+type Discount struct {
+	CouponCode  string
+	Description string
+	Amount      money.Money
+}
+
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (c Coupon) Validate() error {
+	if c.Code == "" {
+		return fmt.Errorf("%w: code is required", ErrInvalidCoupon)
+	}
+
+	if !c.MinOrderValue.IsZero() && (c.MinOrderValue.IsNegative() || !money.ValidCurrency(c.MinOrderValue.Currency)) {
+		return fmt.Errorf("%w: invalid minimum order value", ErrInvalidCoupon)
+	}
+
+	switch c.Kind {
+	case CouponPercentage:
+		if c.Percent == 0 || c.Percent > 100 {
+			return fmt.Errorf("%w: percent must be between 1 and 100", ErrInvalidCoupon)
+		}
+	case CouponFixed:
+		if c.Amount.Amount <= 0 || !money.ValidCurrency(c.Amount.Currency) {
+			return fmt.Errorf("%w: amount must be positive", ErrInvalidCoupon)
+		}
+	case CouponBuyXGetY:
+		if c.ProductID == "" || c.BuyQuantity == 0 || c.FreeQuantity == 0 {
+			return fmt.Errorf("%w: product, buy and free quantities are required", ErrInvalidCoupon)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidCoupon, c.Kind)
+	}
+
+	// Both amounts are stored with a single currency
+	if !c.Amount.IsZero() && !c.MinOrderValue.IsZero() && c.Amount.Currency != c.MinOrderValue.Currency {
+		return fmt.Errorf("%w: amount and minimum order value must be in the same currency", ErrInvalidCoupon)
+	}
+
+	return nil
+}
+
+// Apply evaluates the coupon against an order's products and subtotal. uses
+// is how often the account already used the coupon.
+func (c Coupon) Apply(products []OrderedProduct, subtotal money.Money, now time.Time, uses uint32) (*Discount, error) {
+	if !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt) {
+		return nil, ErrCouponExpired
+	}
+
+	if c.UsageLimit > 0 && uses >= c.UsageLimit {
+		return nil, ErrCouponUsageLimit
+	}
+
+	if !c.MinOrderValue.IsZero() {
+		if c.MinOrderValue.Currency != subtotal.Currency {
+			return nil, fmt.Errorf("%w: minimum order value is in %s", ErrCouponNotApplicable, c.MinOrderValue.Currency)
+		}
+
+		if subtotal.Amount < c.MinOrderValue.Amount {
+			return nil, fmt.Errorf("%w: order must be at least %s", ErrCouponNotApplicable, c.MinOrderValue)
+		}
+	}
+
+	d := &Discount{CouponCode: c.Code}
+
+	switch c.Kind {
+	case CouponPercentage:
+		// Rounded half up to the minor unit
+		d.Amount = money.New((subtotal.Amount*int64(c.Percent)+50)/100, subtotal.Currency)
+		d.Description = fmt.Sprintf("%d%% off", c.Percent)
+	case CouponFixed:
+		if c.Amount.Currency != subtotal.Currency {
+			return nil, fmt.Errorf("%w: discount is in %s", ErrCouponNotApplicable, c.Amount.Currency)
+		}
+
+		d.Amount = c.Amount
+
+		if d.Amount.Amount > subtotal.Amount {
+			d.Amount = subtotal
+		}
+
+		d.Description = fmt.Sprintf("%s off", c.Amount)
+	case CouponBuyXGetY:
+		for _, p := range products {
+			if p.ID != c.ProductID {
+				continue
+			}
+
+			free := p.Quantity / (c.BuyQuantity + c.FreeQuantity) * c.FreeQuantity
+			amount, err := p.Price.Mul(int64(free))
+
+			if err != nil {
+				return nil, err
+			}
+
+			d.Amount = amount
+		}
+
+		d.Description = fmt.Sprintf("buy %d get %d free", c.BuyQuantity, c.FreeQuantity)
+	default:
+		return nil, ErrInvalidCoupon
+	}
+
+	if d.Amount.IsZero() {
+		return nil, ErrCouponNotApplicable
+	}
+
+	return d, nil
+}
+
+func (c Coupon) Proto() *pb.Coupon {
+	out := &pb.Coupon{
+		Code:          c.Code,
+		Kind:          string(c.Kind),
+		Percent:       c.Percent,
+		Amount:        c.Amount.Proto(),
+		ProductId:     c.ProductID,
+		BuyQuantity:   c.BuyQuantity,
+		FreeQuantity:  c.FreeQuantity,
+		MinOrderValue: c.MinOrderValue.Proto(),
+		UsageLimit:    c.UsageLimit,
+	}
+
+	if !c.ExpiresAt.IsZero() {
+		out.ExpiresAt, _ = c.ExpiresAt.MarshalBinary()
+	}
+
+	return out
+}
+
+func CouponFromProto(p *pb.Coupon) Coupon {
+	c := Coupon{
+		Code:          p.Code,
+		Kind:          CouponKind(p.Kind),
+		Percent:       p.Percent,
+		Amount:        money.FromProto(p.Amount),
+		ProductID:     p.ProductId,
+		BuyQuantity:   p.BuyQuantity,
+		FreeQuantity:  p.FreeQuantity,
+		MinOrderValue: money.FromProto(p.MinOrderValue),
+		UsageLimit:    p.UsageLimit,
+	}
+
+	if len(p.ExpiresAt) > 0 {
+		c.ExpiresAt.UnmarshalBinary(p.ExpiresAt)
+	}
+
+	return c
+}
@@ -0,0 +1,58 @@
+package order
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+	"github.com/segmentio/ksuid"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// orderCursor holds the sort keys of an order, enough to resume a listing
+// from it in any sort order.
+type orderCursor struct {
+	ID       string
+	Total    int64
+	Currency string
+}
+
+// Cursors are opaque to clients.
+func encodeCursor(o Order) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(o.ID + ":" + strconv.FormatInt(o.TotalPrice.Amount, 10) + ":" + o.TotalPrice.Currency))
+}
+
+func decodeCursor(cursor string) (orderCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return orderCursor{}, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(b), ":")
+
+	if len(parts) != 3 {
+		return orderCursor{}, ErrInvalidCursor
+	}
+
+	if _, err = ksuid.Parse(parts[0]); err != nil {
+		return orderCursor{}, ErrInvalidCursor
+	}
+
+	if !money.ValidCurrency(parts[2]) {
+		return orderCursor{}, ErrInvalidCursor
+	}
+
+	c := orderCursor{ID: parts[0], Currency: parts[2]}
+
+	if c.Total, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return orderCursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,66 @@
+package order
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testOrderID = "2mYgFzNu5U1cDGfgsJn7IqQ8Eha"
+
+func TestDecodeCursor(t *testing.T) {
+	raw := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name    string
+		cursor  string
+		want    orderCursor
+		wantErr error
+	}{
+		{
+			name:   "round trip",
+			cursor: encodeCursor(Order{ID: testOrderID, TotalPrice: money.New(1999, "EUR")}),
+			want:   orderCursor{ID: testOrderID, Total: 1999, Currency: "EUR"},
+		},
+		{
+			name:   "negative total",
+			cursor: raw(testOrderID + ":-5:JPY"),
+			want:   orderCursor{ID: testOrderID, Total: -5, Currency: "JPY"},
+		},
+		{name: "not base64", cursor: "!!!", wantErr: ErrInvalidCursor},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(testOrderID + ":12:EUR")), wantErr: ErrInvalidCursor},
+		{name: "id only", cursor: raw(testOrderID), wantErr: ErrInvalidCursor},
+		{name: "missing currency", cursor: raw(testOrderID + ":1999"), wantErr: ErrInvalidCursor},
+		{name: "extra part", cursor: raw(testOrderID + ":1999:EUR:x"), wantErr: ErrInvalidCursor},
+		{name: "not a ksuid", cursor: raw("42:1999:EUR"), wantErr: ErrInvalidCursor},
+		{name: "empty total", cursor: raw(testOrderID + "::EUR"), wantErr: ErrInvalidCursor},
+		{name: "decimal total", cursor: raw(testOrderID + ":19.99:EUR"), wantErr: ErrInvalidCursor},
+		{name: "total out of range", cursor: raw(testOrderID + ":9223372036854775808:EUR"), wantErr: ErrInvalidCursor},
+		{name: "empty currency", cursor: raw(testOrderID + ":1999:"), wantErr: ErrInvalidCursor},
+		{name: "lowercase currency", cursor: raw(testOrderID + ":1999:eur"), wantErr: ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decodeCursor() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("decodeCursor() = %+v, want %+v", got, tt.want)
+			}
+
+			if err != nil && status.Code(listError(err)) != codes.InvalidArgument {
+				t.Errorf("listError() = %v, want InvalidArgument", listError(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid order filter")
+)
+
+// maxOrderPageSize bounds the number of orders in a page, which is also the
+// size of a page if none is requested.
+const maxOrderPageSize = 100
+
+type OrderSort string
+
+// Orders sorted by total are grouped by currency, in alphabetical order, and
+// sorted by total within each currency.
+const (
+	SortCreatedAtAsc  OrderSort = "created_at_asc"
+	SortCreatedAtDesc OrderSort = "created_at_desc"
+	SortTotalAsc      OrderSort = "total_asc"
+	SortTotalDesc     OrderSort = "total_desc"
+)
+
+// OrderFilter selects and pages through an account's orders. Zero values
+// don't filter: orders created in [CreatedFrom, CreatedTo) with any of the
+// Statuses and a total within [MinTotal, MaxTotal] match. A total bound only
+// matches orders in its currency. Orders with ProductIDs contain at least
+// one of the products. A non-empty Cursor takes precedence over Skip.
+type OrderFilter struct {
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Statuses    []Status
+	MinTotal    money.Money
+	MaxTotal    money.Money
+	ProductIDs  []string
+	Sort        OrderSort
+	Skip        uint64
+	Take        uint64
+	Cursor      string
+}
+
+// normalize validates the filter and fills in the default sort and page
+// size.
+func (f OrderFilter) normalize() (OrderFilter, error) {
+	if f.Sort == "" {
+		f.Sort = SortCreatedAtAsc
+	}
+
+	switch f.Sort {
+	case SortCreatedAtAsc, SortCreatedAtDesc, SortTotalAsc, SortTotalDesc:
+	default:
+		return f, fmt.Errorf("%w: unknown sort %q", ErrInvalidFilter, f.Sort)
+	}
+
+	for _, s := range f.Statuses {
+		if _, err := ParseStatus(string(s)); err != nil {
+			return f, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, s)
+		}
+	}
+
+	if !f.CreatedFrom.IsZero() && !f.CreatedTo.IsZero() && !f.CreatedFrom.Before(f.CreatedTo) {
+		return f, fmt.Errorf("%w: createdFrom must be before createdTo", ErrInvalidFilter)
+	}
+
+	if min, max := f.MinTotal, f.MaxTotal; min.Currency != "" && max.Currency != "" {
+		if min.Currency != max.Currency {
+			return f, fmt.Errorf("%w: total bounds must be in the same currency", ErrInvalidFilter)
+		}
+
+		if min.Amount > max.Amount {
+			return f, fmt.Errorf("%w: minTotal exceeds maxTotal", ErrInvalidFilter)
+		}
+	}
+
+	if f.Take > maxOrderPageSize || f.Take == 0 {
+		f.Take = maxOrderPageSize
+	}
+
+	// Skip+Take is bound as a BIGINT
+	if f.Skip > math.MaxInt64-maxOrderPageSize {
+		return f, fmt.Errorf("%w: skip is too large", ErrInvalidFilter)
+	}
+
+	if f.Cursor != "" {
+		f.Skip = 0
+	}
+
+	return f, nil
+}
+
+// orderQuery builds the conditions of a query on the orders table, aliased
+// o, from a filter.
+type orderQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *orderQuery) add(condition string, args ...interface{}) {
+	for _, arg := range args {
+		q.args = append(q.args, arg)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(q.args)), 1)
+	}
+
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *orderQuery) where() string {
+	return strings.Join(q.conditions, " AND ")
+}
+
+func newOrderQuery(accountIDs []string, f OrderFilter) *orderQuery {
+	q := &orderQuery{}
+	q.add("o.account_id = ANY(?)", pq.Array(accountIDs))
+
+	if !f.CreatedFrom.IsZero() {
+		q.add("o.created_at >= ?", f.CreatedFrom)
+	}
+
+	if !f.CreatedTo.IsZero() {
+		q.add("o.created_at < ?", f.CreatedTo)
+	}
+
+	if len(f.Statuses) > 0 {
+		q.add("o.status = ANY(?)", pq.Array(f.Statuses))
+	}
+
+	if f.MinTotal.Currency != "" {
+		q.add("o.currency = ? AND o.total_price >= ?", f.MinTotal.Currency, f.MinTotal.Amount)
+	}
+
+	if f.MaxTotal.Currency != "" {
+		q.add("o.currency = ? AND o.total_price <= ?", f.MaxTotal.Currency, f.MaxTotal.Amount)
+	}
+
+	if len(f.ProductIDs) > 0 {
+		q.add(
+			"EXISTS (SELECT 1 FROM order_products fp WHERE fp.order_id = o.id AND fp.product_id = ANY(?))",
+			pq.Array(f.ProductIDs),
+		)
+	}
+
+	return q
+}
+
+// after limits the query to the orders following the cursor's order in the
+// sort order.
+func (q *orderQuery) after(c orderCursor, sort OrderSort) {
+	switch sort {
+	case SortCreatedAtAsc:
+		q.add("o.id > ?", c.ID)
+	case SortCreatedAtDesc:
+		q.add("o.id < ?", c.ID)
+	case SortTotalAsc:
+		q.add("(o.currency, o.total_price, o.id) > (?, ?, ?)", c.Currency, c.Total, c.ID)
+	case SortTotalDesc:
+		q.add("(o.currency > ? OR (o.currency = ? AND (o.total_price, o.id) < (?, ?)))", c.Currency, c.Currency, c.Total, c.ID)
+	}
+}
+
+// orderBy returns the ORDER BY expression of a sort. Order IDs are ksuids,
+// so they sort by creation time and break ties between equal totals.
+func orderBy(sort OrderSort) string {
+	switch sort {
+	case SortCreatedAtDesc:
+		return "o.id DESC"
+	case SortTotalAsc:
+		return "o.currency, o.total_price, o.id"
+	case SortTotalDesc:
+		return "o.currency, o.total_price DESC, o.id DESC"
+	}
+
+	return "o.id"
+}
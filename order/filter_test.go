@@ -0,0 +1,91 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+// Sorting by total groups orders by currency, in ascending order whichever
+// the direction of the sort, so that a page never mixes the totals of
+// different currencies.
+func TestTotalSort(t *testing.T) {
+	c := orderCursor{ID: testOrderID, Total: 1999, Currency: "EUR"}
+
+	tests := []struct {
+		sort      OrderSort
+		orderBy   string
+		condition string
+		args      []interface{}
+	}{
+		{
+			sort:      SortCreatedAtAsc,
+			orderBy:   "o.id",
+			condition: "o.id > $2",
+			args:      []interface{}{testOrderID},
+		},
+		{
+			sort:      SortCreatedAtDesc,
+			orderBy:   "o.id DESC",
+			condition: "o.id < $2",
+			args:      []interface{}{testOrderID},
+		},
+		{
+			sort:      SortTotalAsc,
+			orderBy:   "o.currency, o.total_price, o.id",
+			condition: "(o.currency, o.total_price, o.id) > ($2, $3, $4)",
+			args:      []interface{}{"EUR", int64(1999), testOrderID},
+		},
+		{
+			sort:      SortTotalDesc,
+			orderBy:   "o.currency, o.total_price DESC, o.id DESC",
+			condition: "(o.currency > $2 OR (o.currency = $3 AND (o.total_price, o.id) < ($4, $5)))",
+			args:      []interface{}{"EUR", "EUR", int64(1999), testOrderID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.sort), func(t *testing.T) {
+			if got := orderBy(tt.sort); got != tt.orderBy {
+				t.Errorf("orderBy() = %q, want %q", got, tt.orderBy)
+			}
+
+			q := newOrderQuery([]string{"a"}, OrderFilter{})
+			q.after(c, tt.sort)
+
+			if got := q.conditions[len(q.conditions)-1]; got != tt.condition {
+				t.Errorf("after() = %q, want %q", got, tt.condition)
+			}
+
+			if got := fmt.Sprint(q.args[1:]); got != fmt.Sprint(tt.args) {
+				t.Errorf("after() args = %s, want %v", got, tt.args)
+			}
+		})
+	}
+}
+
+func TestNormalizeTotalBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  OrderFilter
+		wantErr bool
+	}{
+		{name: "no bounds", filter: OrderFilter{}},
+		{name: "min only", filter: OrderFilter{MinTotal: money.New(100, "EUR")}},
+		{name: "same currency", filter: OrderFilter{MinTotal: money.New(100, "EUR"), MaxTotal: money.New(100, "EUR")}},
+		{name: "other currencies", filter: OrderFilter{MinTotal: money.New(100, "EUR"), MaxTotal: money.New(200, "USD")}, wantErr: true},
+		{name: "min above max", filter: OrderFilter{MinTotal: money.New(200, "EUR"), MaxTotal: money.New(100, "EUR")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.filter.normalize()
+
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidFilter)) {
+				t.Errorf("normalize() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+var (
+	ErrPaymentDeclined   = errors.New("payment declined")
+	ErrPaymentFailed     = errors.New("payment could not be captured")
+	ErrPaymentInProgress = errors.New("order already has a payment in progress")
+)
+
+// PaymentProvider moves the money for orders. Amounts are authorized against
+// a payment token first, e.g. a card tokenized by the client, and captured
+// afterwards. Authorizations that won't be captured are voided, captured
+// amounts can be refunded in part or in full.
+type PaymentProvider interface {
+	Name() string
+	// Authorize returns the provider's reference of the authorization.
+	Authorize(ctx context.Context, orderID, token string, amount money.Money) (string, error)
+	Capture(ctx context.Context, reference string, amount money.Money) error
+	// Refund returns the provider's reference of the refund.
+	Refund(ctx context.Context, reference string, amount money.Money) (string, error)
+	Void(ctx context.Context, reference string) error
+}
+
+type PaymentStatus string
+
+const (
+	PaymentPending    PaymentStatus = "pending"
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	PaymentDeclined   PaymentStatus = "declined"
+	PaymentVoided     PaymentStatus = "voided"
+	PaymentRefunded   PaymentStatus = "refunded"
+	// PaymentVoidFailed is an authorization that wasn't captured and
+	// couldn't be voided either, so the provider may still hold the amount.
+	PaymentVoidFailed PaymentStatus = "void_failed"
+)
+
+// Payment is the payment of an order. Reference is the provider's reference
+// of the authorization, empty until the amount is authorized.
+type Payment struct {
+	OrderID   string
+	Provider  string
+	Reference string
+	Status    PaymentStatus
+	Amount    money.Money
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Tokens the fake provider treats specially. Every other token is approved.
+const (
+	FakeTokenDeclined     = "tok_declined"
+	FakeTokenCaptureFails = "tok_capture_fails"
+)
+
+// FakePaymentProvider is an in-process PaymentProvider for development and
+// tests. Its behavior only depends on the token and the calls made, and it
+// keeps its state in memory.
+type FakePaymentProvider struct {
+	mu             sync.Mutex
+	next           int
+	authorizations map[string]*fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	token    string
+	amount   money.Money
+	captured money.Money
+	refunded money.Money
+	voided   bool
+}
+
+func NewFakePaymentProvider() *FakePaymentProvider {
+	return &FakePaymentProvider{authorizations: map[string]*fakeAuthorization{}}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakePaymentProvider) Authorize(ctx context.Context, orderID, token string, amount money.Money) (string, error) {
+	if token == FakeTokenDeclined || amount.Amount <= 0 {
+		return "", fmt.Errorf("fake payments: %s declined for order %s", amount, orderID)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next++
+	reference := fmt.Sprintf("fake_auth_%d_%s", p.next, orderID)
+	p.authorizations[reference] = &fakeAuthorization{token: token, amount: amount}
+
+	return reference, nil
+}
+
+func (p *FakePaymentProvider) Capture(ctx context.Context, reference string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.authorizations[reference]
+
+	switch {
+	case !ok || a.voided:
+		return fmt.Errorf("fake payments: no open authorization %s", reference)
+	case a.token == FakeTokenCaptureFails:
+		return fmt.Errorf("fake payments: capture of %s failed", reference)
+	case amount.Currency != a.amount.Currency || a.captured.Amount+amount.Amount > a.amount.Amount:
+		return fmt.Errorf("fake payments: %s exceeds the authorization %s", amount, reference)
+	}
+
+	a.captured = money.New(a.captured.Amount+amount.Amount, amount.Currency)
+
+	return nil
+}
+
+func (p *FakePaymentProvider) Refund(ctx context.Context, reference string, amount money.Money) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.authorizations[reference]
+
+	switch {
+	case !ok:
+		return "", fmt.Errorf("fake payments: unknown authorization %s", reference)
+	case amount.Amount <= 0 || amount.Currency != a.captured.Currency || a.refunded.Amount+amount.Amount > a.captured.Amount:
+		return "", fmt.Errorf("fake payments: %s exceeds the captured amount of %s", amount, reference)
+	}
+
+	a.refunded = money.New(a.refunded.Amount+amount.Amount, amount.Currency)
+	p.next++
+
+	return fmt.Sprintf("fake_refund_%d_%s", p.next, reference), nil
+}
+
+func (p *FakePaymentProvider) Void(ctx context.Context, reference string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.authorizations[reference]
+
+	if !ok || a.captured.Amount > 0 {
+		return fmt.Errorf("fake payments: can't void %s", reference)
+	}
+
+	a.voided = true
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package order
+
+import (
+	"errors"
+	"time"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+var (
+	ErrInvalidRefund  = errors.New("invalid refund")
+	ErrNotRefundable  = errors.New("order has no captured payment")
+	ErrRefundExceeded = errors.New("refund exceeds what is left to refund")
+	ErrRefundFailed   = errors.New("payment could not be refunded")
+)
+
+// maxReasonLength bounds the reasons given for cancellations and refunds.
+const maxReasonLength = 500
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	RefundFailed    RefundStatus = "failed"
+)
+
+// Refund gives back part or all of an order's captured payment. Reference
+// is the payment provider's reference of the refund, empty unless it
+// succeeded. Failed refunds are kept for the record but don't count towards
+// the refunded amount.
+type Refund struct {
+	ID        string
+	OrderID   string
+	Reference string
+	Status    RefundStatus
+	Amount    money.Money
+	Reason    string
+	Actor     string
+	Lines     []RefundLine
+	CreatedAt time.Time
+}
+
+// RefundLine is the refunded quantity of an order line. Amount is its share
+// of the refund, including tax and net of discounts.
+type RefundLine struct {
+	ProductID string
+	Quantity  uint32
+	Amount    money.Money
+}
+
+// refunded returns the amount refunded so far.
+func (o Order) refunded() int64 {
+	var amount int64
+
+	for _, r := range o.Refunds {
+		if r.Status != RefundFailed {
+			amount += r.Amount.Amount
+		}
+	}
+
+	return amount
+}
+
+// refundableQuantities returns the quantity of each line that hasn't been
+// refunded yet.
+func (o Order) refundableQuantities() map[string]uint32 {
+	quantities := map[string]uint32{}
+
+	for _, p := range o.Products {
+		quantities[p.ID] = p.Quantity
+	}
+
+	for _, r := range o.Refunds {
+		if r.Status == RefundFailed {
+			continue
+		}
+
+		for _, l := range r.Lines {
+			quantities[l.ProductID] -= l.Quantity
+		}
+	}
+
+	return quantities
+}
+
+// unrefundedLines returns a refund line for every line of the order that
+// hasn't been fully refunded, with the quantity left.
+func (o Order) unrefundedLines() []RefundLine {
+	quantities := o.refundableQuantities()
+	lines := []RefundLine{}
+
+	for _, p := range o.Products {
+		if q := quantities[p.ID]; q > 0 {
+			lines = append(lines, RefundLine{ProductID: p.ID, Quantity: q})
+		}
+	}
+
+	return lines
+}
+
+// lineTotals returns what was charged for each line of the order: its price
+// net of its share of the discounts, plus its tax. Discounts are spread over
+// the lines in proportion to their price, the last line taking the rounding
+// remainder, so the totals add up to the order's total.
+func (o Order) lineTotals() []int64 {
+	var discount int64
+
+	for _, d := range o.Discounts {
+		discount += d.Amount.Amount
+	}
+
+	totals := make([]int64, len(o.Products))
+	remaining := discount
+
+	for i, p := range o.Products {
+		line := p.Price.Amount * int64(p.Quantity)
+		share := remaining
+
+		if i < len(o.Products)-1 && o.Subtotal.Amount > 0 {
+			share = discount * line / o.Subtotal.Amount
+		}
+
+		remaining -= share
+		totals[i] = line - share + p.Tax.Amount
+	}
+
+	return totals
+}
+
+// refundLines computes the lines of a refund of the requested quantities and
+// their amount, in the currency of the payment. Each line is refunded its
+// share of what was charged for it, rounded down, and the refund that leaves
+// nothing to refund takes whatever is left of the payment, so the refunds
+// add up to exactly what was paid. complete reports whether it's that
+// refund.
+func (o Order) refundLines(requested map[string]uint32) (lines []RefundLine, amount int64, complete bool) {
+	currency := o.Payment.Amount.Currency
+	totals := o.lineTotals()
+	left := o.refundableQuantities()
+	complete = true
+
+	for i, p := range o.Products {
+		q := requested[p.ID]
+
+		if q < left[p.ID] {
+			complete = false
+		}
+
+		if q == 0 {
+			continue
+		}
+
+		share := totals[i] * int64(q) / int64(p.Quantity)
+		lines = append(lines, RefundLine{ProductID: p.ID, Quantity: q, Amount: money.New(share, currency)})
+		amount += share
+	}
+
+	if complete && len(lines) > 0 {
+		rest := o.Payment.Amount.Amount - o.refunded() - amount
+		lines[len(lines)-1].Amount.Amount += rest
+		amount += rest
+	}
+
+	return lines, amount, complete
+}
@@ -0,0 +1,200 @@
+package order
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+// line returns an order line of quantity units at price, with tax on the
+// whole line.
+func line(id string, price int64, quantity uint32, tax int64) OrderedProduct {
+	return OrderedProduct{
+		ID:       id,
+		Price:    money.New(price, "EUR"),
+		Quantity: quantity,
+		Tax:      money.New(tax, "EUR"),
+	}
+}
+
+// testOrder returns an order of the lines with a discount, paid in full.
+func testOrder(discount int64, products ...OrderedProduct) Order {
+	o := Order{Products: products}
+
+	for _, p := range products {
+		o.Subtotal.Amount += p.Price.Amount * int64(p.Quantity)
+		o.Tax.Amount += p.Tax.Amount
+	}
+
+	if discount > 0 {
+		o.Discounts = []Discount{{Amount: money.New(discount, "EUR")}}
+	}
+
+	o.TotalPrice = money.New(o.Subtotal.Amount-discount+o.Tax.Amount, "EUR")
+	o.Payment = &Payment{Status: PaymentCaptured, Amount: o.TotalPrice}
+
+	return o
+}
+
+func TestLineTotals(t *testing.T) {
+	tests := []struct {
+		name  string
+		order Order
+		want  []int64
+	}{
+		{
+			name:  "no discount",
+			order: testOrder(0, line("a", 1000, 2, 380), line("b", 500, 1, 95)),
+			want:  []int64{2380, 595},
+		},
+		{
+			name:  "discount in proportion to price",
+			order: testOrder(300, line("a", 1000, 2, 0), line("b", 500, 1, 0)),
+			want:  []int64{1760, 440},
+		},
+		{
+			name:  "last line takes the rounding remainder",
+			order: testOrder(100, line("a", 1000, 1, 0), line("b", 1000, 1, 0), line("c", 1000, 1, 0)),
+			want:  []int64{967, 967, 966},
+		},
+		{
+			name:  "discount with tax",
+			order: testOrder(200, line("a", 1000, 1, 152), line("b", 1000, 1, 152)),
+			want:  []int64{1052, 1052},
+		},
+		{
+			name:  "free line",
+			order: testOrder(100, line("a", 1000, 1, 0), line("b", 0, 1, 0)),
+			want:  []int64{900, 0},
+		},
+		{
+			name:  "everything free",
+			order: testOrder(0, line("a", 0, 1, 0), line("b", 0, 2, 0)),
+			want:  []int64{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.order.lineTotals()
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lineTotals() = %v, want %v", got, tt.want)
+			}
+
+			var sum int64
+
+			for _, total := range got {
+				sum += total
+			}
+
+			if sum != tt.order.TotalPrice.Amount {
+				t.Errorf("line totals add up to %d, want the order total %d", sum, tt.order.TotalPrice.Amount)
+			}
+		})
+	}
+}
+
+func TestRefundLines(t *testing.T) {
+	type step struct {
+		requested map[string]uint32
+		// failed refunds are kept but don't count
+		failed       bool
+		wantAmount   int64
+		wantComplete bool
+	}
+
+	tests := []struct {
+		name  string
+		order Order
+		steps []step
+	}{
+		{
+			name:  "single refund of everything",
+			order: testOrder(100, line("a", 1000, 1, 0), line("b", 1000, 1, 0), line("c", 1000, 1, 0)),
+			steps: []step{
+				{requested: map[string]uint32{"a": 1, "b": 1, "c": 1}, wantAmount: 2900, wantComplete: true},
+			},
+		},
+		{
+			name:  "partial then complete",
+			order: testOrder(100, line("a", 1000, 1, 0), line("b", 1000, 1, 0), line("c", 1000, 1, 0)),
+			steps: []step{
+				{requested: map[string]uint32{"a": 1}, wantAmount: 967},
+				{requested: map[string]uint32{"b": 1, "c": 1}, wantAmount: 1933, wantComplete: true},
+			},
+		},
+		{
+			name:  "units of a line one by one",
+			order: testOrder(100, line("a", 1000, 3, 0)),
+			steps: []step{
+				{requested: map[string]uint32{"a": 1}, wantAmount: 966},
+				{requested: map[string]uint32{"a": 1}, wantAmount: 966},
+				{requested: map[string]uint32{"a": 1}, wantAmount: 968, wantComplete: true},
+			},
+		},
+		{
+			name:  "with tax and discount",
+			order: testOrder(250, line("a", 1999, 3, 1026), line("b", 499, 2, 171)),
+			steps: []step{
+				{requested: map[string]uint32{"a": 2}, wantAmount: 4539},
+				{requested: map[string]uint32{"b": 1}, wantAmount: 566},
+				{requested: map[string]uint32{"a": 1, "b": 1}, wantAmount: 2837, wantComplete: true},
+			},
+		},
+		{
+			name:  "free line",
+			order: testOrder(0, line("a", 1000, 1, 0), line("b", 0, 2, 0)),
+			steps: []step{
+				{requested: map[string]uint32{"b": 2}, wantAmount: 0},
+				{requested: map[string]uint32{"a": 1}, wantAmount: 1000, wantComplete: true},
+			},
+		},
+		{
+			name:  "failed refund is retried",
+			order: testOrder(100, line("a", 1000, 1, 0), line("b", 1000, 1, 0), line("c", 1000, 1, 0)),
+			steps: []step{
+				{requested: map[string]uint32{"a": 1}, wantAmount: 967},
+				{requested: map[string]uint32{"b": 1, "c": 1}, failed: true, wantAmount: 1933, wantComplete: true},
+				{requested: map[string]uint32{"b": 1, "c": 1}, wantAmount: 1933, wantComplete: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := tt.order
+
+			for i, s := range tt.steps {
+				lines, amount, complete := o.refundLines(s.requested)
+
+				if amount != s.wantAmount || complete != s.wantComplete {
+					t.Fatalf("step %d: refundLines() = %d, complete %t, want %d, complete %t", i, amount, complete, s.wantAmount, s.wantComplete)
+				}
+
+				var sum int64
+
+				for _, l := range lines {
+					sum += l.Amount.Amount
+				}
+
+				if sum != amount {
+					t.Fatalf("step %d: lines add up to %d, want %d", i, sum, amount)
+				}
+
+				status := RefundSucceeded
+
+				if s.failed {
+					status = RefundFailed
+				}
+
+				o.Refunds = append(o.Refunds, Refund{Status: status, Amount: money.New(amount, "EUR"), Lines: lines})
+			}
+
+			if got := o.refunded(); got != o.Payment.Amount.Amount {
+				t.Errorf("refunds add up to %d, want the payment %d", got, o.Payment.Amount.Amount)
+			}
+		})
+	}
+}
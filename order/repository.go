@@ -3,15 +3,45 @@ package order
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/azizkhan030/go-grpc-graphql/account"
+	"github.com/azizkhan030/go-grpc-graphql/money"
 	"github.com/lib/pq"
 )
 
+var (
+	ErrNotFound = errors.New("entity not found")
+
+	ErrCouponExists = errors.New("coupon already exists")
+
+	errDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+)
+
 type Repository interface {
 	Close()
-	PutOrder(ctx context.Context, o Order) error
-	GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error)
+	PutOrder(ctx context.Context, o Order, idempotencyKey, fingerprint string) error
+	GetOrderByID(ctx context.Context, id string) (*Order, error)
+	GetOrderByIdempotencyKey(ctx context.Context, accountID, key string) (*Order, string, error)
+	TransitionOrder(ctx context.Context, id string, from Status, change StatusChange) error
+	GetOrdersForAccount(ctx context.Context, accountID string, f OrderFilter) ([]Order, error)
+	GetOrdersForAccounts(ctx context.Context, accountIDs []string, f OrderFilter) ([]Order, error)
+	CountOrdersForAccount(ctx context.Context, accountID string, f OrderFilter) (uint64, error)
+	CountOrdersForAccounts(ctx context.Context, accountIDs []string, f OrderFilter) (map[string]uint64, error)
+	PutCoupon(ctx context.Context, c Coupon) error
+	GetCoupon(ctx context.Context, code string) (*Coupon, error)
+	CountCouponUses(ctx context.Context, code, accountID string) (uint32, error)
+	GetCartItems(ctx context.Context, accountID string) ([]CartItem, error)
+	PutCartItem(ctx context.Context, accountID string, item CartItem) error
+	DeleteCartItem(ctx context.Context, accountID, productID string) error
+	RemoveCartItems(ctx context.Context, accountID string, items []CartItem) error
+	StartPayment(ctx context.Context, p Payment) error
+	UpdatePayment(ctx context.Context, orderID string, status PaymentStatus, reference string) error
+	PutRefund(ctx context.Context, r Refund) error
+	UpdateRefund(ctx context.Context, id string, status RefundStatus, reference string) error
+	PutStockFailure(ctx context.Context, f StockFailure) error
 }
 
 type dbRepository struct {
@@ -19,19 +49,36 @@ type dbRepository struct {
 }
 
 type Order struct {
-	ID         string
-	CreatedAt  time.Time
-	TotalPrice float64
-	AccountID  string
-	Products   []OrderedProduct
+	ID            string
+	CreatedAt     time.Time
+	Subtotal      money.Money
+	Tax           money.Money
+	TotalPrice    money.Money
+	Discounts     []Discount
+	TaxRegion     string
+	AccountID     string
+	Status        Status
+	StatusHistory []StatusChange
+	Products      []OrderedProduct
+	// ShippingAddress is a snapshot taken when the order was placed. Its ID
+	// is the address book entry it was copied from, if any.
+	ShippingAddress *account.Address
+	Payment         *Payment
+	Refunds         []Refund
 }
 
+// OrderedProduct is a line of an order. Name, Price, ExchangeRate,
+// TaxCategory and Tax are stored with the order, while Description is looked
+// up in the catalog. Tax is the tax on the whole line.
 type OrderedProduct struct {
-	ID          string
-	Name        string
-	Description string
-	Price       float64
-	Quantity    uint32
+	ID           string
+	Name         string
+	Description  string
+	Price        money.Money
+	ExchangeRate string
+	TaxCategory  string
+	Tax          money.Money
+	Quantity     uint32
 }
 
 func NewDbRepository(url string) (Repository, error) {
@@ -54,128 +101,1144 @@ func (r *dbRepository) Close() {
 	r.db.Close()
 }
 
-func (r *dbRepository) PutOrder(ctx context.Context, o Order) error {
+// withTx runs fn in a transaction, which is committed if fn succeeds and
+// rolled back otherwise.
+func (r *dbRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 
 	if err != nil {
 		return err
 	}
 
-	defer func() {
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PutOrder stores a new order. An empty idempotency key is stored as NULL, so
+// it never collides with other orders. The expiry and usage limits of the
+// applied coupons are checked again while their rows are locked, so
+// concurrent orders can't use a coupon more often than allowed, or after it
+// expired.
+func (r *dbRepository) PutOrder(ctx context.Context, o Order, idempotencyKey, fingerprint string) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO orders(id, created_at, account_id, subtotal, tax, total_price, currency, tax_region, status, idempotency_key, fingerprint)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, NULLIF($10, ''), NULLIF($11, ''))`,
+			o.ID,
+			o.CreatedAt,
+			o.AccountID,
+			o.Subtotal.Amount,
+			o.Tax.Amount,
+			o.TotalPrice.Amount,
+			o.TotalPrice.Currency,
+			o.TaxRegion,
+			o.Status,
+			idempotencyKey,
+			fingerprint,
+		)
+
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "orders_idempotency_key" {
+			return errDuplicateIdempotencyKey
+		}
+
+		if err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("order_products", "order_id", "product_id", "quantity", "name", "price", "currency", "exchange_rate", "tax_category", "tax"))
+
+		if err != nil {
+			return err
+		}
+
+		defer stmt.Close()
+
+		for _, p := range o.Products {
+			if _, err = stmt.ExecContext(ctx, o.ID, p.ID, p.Quantity, p.Name, p.Price.Amount, p.Price.Currency, nullString(p.ExchangeRate), p.TaxCategory, p.Tax.Amount); err != nil {
+				return err
+			}
+		}
+
+		if _, err = stmt.ExecContext(ctx); err != nil {
+			return err
+		}
+
+		for _, c := range o.StatusHistory {
+			if err = insertStatusChange(ctx, tx, o.ID, c); err != nil {
+				return err
+			}
+		}
+
+		if a := o.ShippingAddress; a != nil {
+			if _, err = tx.ExecContext(
+				ctx,
+				`INSERT INTO order_addresses(order_id, address_id, name, line1, line2, city, region, postal_code, country)
+				VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9)`,
+				o.ID,
+				a.ID,
+				a.Name,
+				a.Line1,
+				a.Line2,
+				a.City,
+				a.Region,
+				a.PostalCode,
+				a.Country,
+			); err != nil {
+				return err
+			}
+		}
+
+		for _, d := range o.Discounts {
+			if err = checkCoupon(ctx, tx, d.CouponCode, o.AccountID, o.CreatedAt); err != nil {
+				return err
+			}
+
+			if _, err = tx.ExecContext(
+				ctx,
+				"INSERT INTO order_discounts(order_id, coupon_code, description, amount, currency) VALUES ($1, $2, $3, $4, $5)",
+				o.ID,
+				d.CouponCode,
+				d.Description,
+				d.Amount.Amount,
+				d.Amount.Currency,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func checkCoupon(ctx context.Context, tx *sql.Tx, code, accountID string, now time.Time) error {
+	var limit uint32
+	var expiresAt sql.NullTime
+
+	err := tx.QueryRowContext(ctx, "SELECT usage_limit, expires_at FROM coupons WHERE code = $1 FOR UPDATE", code).Scan(&limit, &expiresAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCouponNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if expiresAt.Valid && !now.Before(expiresAt.Time) {
+		return ErrCouponExpired
+	}
+
+	if limit == 0 {
+		return nil
+	}
+
+	uses, err := countCouponUses(ctx, tx, code, accountID)
+
+	if err != nil {
+		return err
+	}
+
+	if uses >= limit {
+		return ErrCouponUsageLimit
+	}
+
+	return nil
+}
+
+// TransitionOrder moves the order from one status to another. The update is
+// conditional on the current status, so concurrent transitions can't both
+// succeed.
+func (r *dbRepository) TransitionOrder(ctx context.Context, id string, from Status, change StatusChange) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(
+			ctx,
+			"UPDATE orders SET status = $3 WHERE id = $1 AND status = $2",
+			id,
+			from,
+			change.Status,
+		)
+
 		if err != nil {
-			tx.Rollback()
-			return
+			return err
 		}
 
-		err = tx.Commit()
-	}()
+		n, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return ErrInvalidTransition
+		}
+
+		return insertStatusChange(ctx, tx, id, change)
+	})
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func insertStatusChange(ctx context.Context, tx *sql.Tx, orderID string, c StatusChange) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO order_status_history(order_id, status, changed_at, actor, reason) VALUES ($1, $2, $3, $4, $5)",
+		orderID,
+		c.Status,
+		c.ChangedAt,
+		c.Actor,
+		c.Reason,
+	)
+
+	return err
+}
+
+// attachStatusHistory loads the status history of the given orders with a
+// single query.
+func (r *dbRepository) attachStatusHistory(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(orders))
+	index := map[string]int{}
 
-	if _, err = tx.ExecContext(
+	for i, o := range orders {
+		ids = append(ids, o.ID)
+		index[o.ID] = i
+	}
+
+	rows, err := r.db.QueryContext(
 		ctx,
-		"INSERT INTO orders(id, created_at, account_id, total_price) VALUES ($1, $2, $3, $4)",
-		o.ID,
-		o.CreatedAt,
-		o.AccountID,
-		o.TotalPrice,
-	); err != nil {
+		`SELECT order_id, status, changed_at, actor, reason
+		FROM order_status_history
+		WHERE order_id = ANY($1)
+		ORDER BY changed_at, id`,
+		pq.Array(ids),
+	)
+
+	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("order_products", "order_id", "product_id", "quantity"))
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		c := StatusChange{}
+
+		if err := rows.Scan(&orderID, &c.Status, &c.ChangedAt, &c.Actor, &c.Reason); err != nil {
+			return err
+		}
+
+		o := &orders[index[orderID]]
+		o.StatusHistory = append(o.StatusHistory, c)
+	}
+
+	return rows.Err()
+}
+
+// attachDiscounts loads the discount lines of the given orders with a single
+// query.
+func (r *dbRepository) attachDiscounts(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(orders))
+	index := map[string]int{}
+
+	for i, o := range orders {
+		ids = append(ids, o.ID)
+		index[o.ID] = i
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT order_id, coupon_code, description, amount, currency
+		FROM order_discounts
+		WHERE order_id = ANY($1)
+		ORDER BY id`,
+		pq.Array(ids),
+	)
 
 	if err != nil {
 		return err
 	}
 
-	defer stmt.Close()
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		d := Discount{}
 
-	for _, p := range o.Products {
-		if _, err = stmt.ExecContext(ctx, o.ID, p.ID, p.Quantity); err != nil {
+		if err := rows.Scan(&orderID, &d.CouponCode, &d.Description, &d.Amount.Amount, &d.Amount.Currency); err != nil {
 			return err
 		}
+
+		o := &orders[index[orderID]]
+		o.Discounts = append(o.Discounts, d)
 	}
 
-	if _, err := stmt.ExecContext(ctx); err != nil {
+	return rows.Err()
+}
+
+// attachShippingAddresses loads the shipping addresses of the given orders
+// with a single query.
+func (r *dbRepository) attachShippingAddresses(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(orders))
+	index := map[string]int{}
+
+	for i, o := range orders {
+		ids = append(ids, o.ID)
+		index[o.ID] = i
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT order_id, COALESCE(address_id, ''), name, line1, line2, city, region, postal_code, country
+		FROM order_addresses
+		WHERE order_id = ANY($1)`,
+		pq.Array(ids),
+	)
+
+	if err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		a := &account.Address{}
+
+		if err := rows.Scan(&orderID, &a.ID, &a.Name, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country); err != nil {
+			return err
+		}
+
+		o := &orders[index[orderID]]
+		a.AccountID = o.AccountID
+		o.ShippingAddress = a
+	}
+
+	return rows.Err()
+}
+
+// attachPayments loads the payments of the given orders with a single query.
+func (r *dbRepository) attachPayments(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(orders))
+	index := map[string]int{}
+
+	for i, o := range orders {
+		ids = append(ids, o.ID)
+		index[o.ID] = i
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT order_id, provider, reference, status, amount, currency, created_at, updated_at
+		FROM payments
+		WHERE order_id = ANY($1)`,
+		pq.Array(ids),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &Payment{}
+
+		if err := rows.Scan(&p.OrderID, &p.Provider, &p.Reference, &p.Status, &p.Amount.Amount, &p.Amount.Currency, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return err
+		}
+
+		orders[index[p.OrderID]].Payment = p
+	}
+
+	return rows.Err()
 }
 
-func (r *dbRepository) GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error) {
+// attachRefunds loads the refunds of the given orders and their lines with a
+// single query.
+func (r *dbRepository) attachRefunds(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(orders))
+	index := map[string]int{}
+
+	for i, o := range orders {
+		ids = append(ids, o.ID)
+		index[o.ID] = i
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT r.id, r.order_id, r.reference, r.status, r.amount, r.currency, r.reason, r.actor, r.created_at,
+		rl.product_id, rl.quantity, rl.amount
+		FROM refunds r JOIN refund_lines rl ON(r.id = rl.refund_id)
+		WHERE r.order_id = ANY($1)
+		ORDER BY r.created_at, r.id`,
+		pq.Array(ids),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		refund := Refund{}
+		line := RefundLine{}
+
+		if err := rows.Scan(
+			&refund.ID,
+			&refund.OrderID,
+			&refund.Reference,
+			&refund.Status,
+			&refund.Amount.Amount,
+			&refund.Amount.Currency,
+			&refund.Reason,
+			&refund.Actor,
+			&refund.CreatedAt,
+			&line.ProductID,
+			&line.Quantity,
+			&line.Amount.Amount,
+		); err != nil {
+			return err
+		}
+
+		line.Amount.Currency = refund.Amount.Currency
+		o := &orders[index[refund.OrderID]]
+
+		if n := len(o.Refunds); n == 0 || o.Refunds[n-1].ID != refund.ID {
+			o.Refunds = append(o.Refunds, refund)
+		}
+
+		last := &o.Refunds[len(o.Refunds)-1]
+		last.Lines = append(last.Lines, line)
+	}
+
+	return rows.Err()
+}
+
+func (r *dbRepository) GetOrderByID(ctx context.Context, id string) (*Order, error) {
 	rows, err := r.db.QueryContext(
 		ctx,
 		`SELECT
 		o.id,
-		o.created_atm
+		o.created_at,
 		o.account_id,
-		o.total_price::money::numeric::float8,
+		o.subtotal,
+		o.tax,
+		o.total_price,
+		o.currency,
+		COALESCE(o.tax_region, ''),
+		o.status,
 		op.product_id,
-		op.quantity
+		op.quantity,
+		op.name,
+		op.price,
+		op.currency,
+		COALESCE(op.exchange_rate::text, ''),
+		op.tax_category,
+		op.tax
 		FROM orders o JOIN order_products op ON(o.id = op.order_id)
-		ORDER BY o.id`,
+		WHERE o.id = $1`,
+		id,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := scanOrders(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(orders) == 0 {
+		return nil, ErrNotFound
+	}
+
+	if err = r.attachStatusHistory(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	if err = r.attachDiscounts(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	if err = r.attachShippingAddresses(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	if err = r.attachPayments(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	if err = r.attachRefunds(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return &orders[0], nil
+}
+
+// GetOrderByIdempotencyKey returns the order the account placed with the
+// given idempotency key, along with the fingerprint of its request payload.
+func (r *dbRepository) GetOrderByIdempotencyKey(ctx context.Context, accountID, key string) (*Order, string, error) {
+	var id, fingerprint string
+
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT id, fingerprint FROM orders WHERE account_id = $1 AND idempotency_key = $2",
 		accountID,
+		key,
+	).Scan(&id, &fingerprint)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrNotFound
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	o, err := r.GetOrderByID(ctx, id)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return o, fingerprint, nil
+}
+
+func (r *dbRepository) GetOrdersForAccount(ctx context.Context, accountID string, f OrderFilter) ([]Order, error) {
+	return r.GetOrdersForAccounts(ctx, []string{accountID}, f)
+}
+
+// GetOrdersForAccounts returns a page of the matching orders of every given
+// account in a single query. Orders are grouped by account and sorted within
+// each group, skipping f.Skip and taking f.Take orders per account.
+func (r *dbRepository) GetOrdersForAccounts(ctx context.Context, accountIDs []string, f OrderFilter) ([]Order, error) {
+	q := newOrderQuery(accountIDs, f)
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		q.after(c, f.Sort)
+	}
+
+	q.args = append(q.args, f.Skip, f.Skip+f.Take)
+	n := len(q.args)
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		fmt.Sprintf(`WITH page AS (
+			SELECT o.id, ROW_NUMBER() OVER (PARTITION BY o.account_id ORDER BY %s) AS rank
+			FROM orders o
+			WHERE %s
+		)
+		SELECT
+		o.id,
+		o.created_at,
+		o.account_id,
+		o.subtotal,
+		o.tax,
+		o.total_price,
+		o.currency,
+		COALESCE(o.tax_region, ''),
+		o.status,
+		op.product_id,
+		op.quantity,
+		op.name,
+		op.price,
+		op.currency,
+		COALESCE(op.exchange_rate::text, ''),
+		op.tax_category,
+		op.tax
+		FROM page p JOIN orders o ON(o.id = p.id) JOIN order_products op ON(o.id = op.order_id)
+		WHERE p.rank > $%d AND p.rank <= $%d
+		ORDER BY o.account_id, p.rank`, orderBy(f.Sort), q.where(), n-1, n),
+		q.args...,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	orders, err := scanOrders(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.attachStatusHistory(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	if err = r.attachDiscounts(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	if err = r.attachShippingAddresses(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	if err = r.attachPayments(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	if err = r.attachRefunds(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// scanOrders folds the rows of an orders/order_products join, which must be
+// ordered by order ID, into orders with their products.
+func scanOrders(rows *sql.Rows) ([]Order, error) {
 	defer rows.Close()
 
 	orders := []Order{}
-	lastOrder := &Order{}
-	orderedProduct := &OrderedProduct{}
-	products := []OrderedProduct{}
-	order := Order{}
 
 	for rows.Next() {
-		if err = rows.Scan(
+		order := Order{}
+		product := OrderedProduct{}
+
+		if err := rows.Scan(
 			&order.ID,
 			&order.CreatedAt,
 			&order.AccountID,
-			&order.TotalPrice,
-			&orderedProduct.ID,
-			&orderedProduct.Quantity,
+			&order.Subtotal.Amount,
+			&order.Tax.Amount,
+			&order.TotalPrice.Amount,
+			&order.TotalPrice.Currency,
+			&order.TaxRegion,
+			&order.Status,
+			&product.ID,
+			&product.Quantity,
+			&product.Name,
+			&product.Price.Amount,
+			&product.Price.Currency,
+			&product.ExchangeRate,
+			&product.TaxCategory,
+			&product.Tax.Amount,
 		); err != nil {
 			return nil, err
 		}
 
-		if lastOrder.ID != "" && lastOrder.ID != order.ID {
-			newOrder := Order{
-				ID:         lastOrder.ID,
-				AccountID:  lastOrder.AccountID,
-				CreatedAt:  lastOrder.CreatedAt,
-				TotalPrice: lastOrder.TotalPrice,
-				Products:   lastOrder.Products,
-			}
+		order.Subtotal.Currency = order.TotalPrice.Currency
+		order.Tax.Currency = order.TotalPrice.Currency
+		product.Tax.Currency = product.Price.Currency
 
-			orders = append(orders, newOrder)
-			products = []OrderedProduct{}
+		if n := len(orders); n == 0 || orders[n-1].ID != order.ID {
+			orders = append(orders, order)
 		}
-		products = append(products, OrderedProduct{
-			ID:       orderedProduct.ID,
-			Quantity: orderedProduct.Quantity,
-		})
 
-		*lastOrder = *&order
+		last := &orders[len(orders)-1]
+		last.Products = append(last.Products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (r *dbRepository) CountOrdersForAccount(ctx context.Context, accountID string, f OrderFilter) (uint64, error) {
+	counts, err := r.CountOrdersForAccounts(ctx, []string{accountID}, f)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return counts[accountID], nil
+}
+
+// CountOrdersForAccounts counts the orders of every given account matching
+// the filter, regardless of its sort and paging.
+func (r *dbRepository) CountOrdersForAccounts(ctx context.Context, accountIDs []string, f OrderFilter) (map[string]uint64, error) {
+	q := newOrderQuery(accountIDs, f)
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT o.account_id, COUNT(*) FROM orders o WHERE "+q.where()+" GROUP BY o.account_id",
+		q.args...,
+	)
+
+	if err != nil {
+		return nil, err
 	}
 
-	if lastOrder != nil {
-		newOrder := Order{
-			ID:         lastOrder.ID,
-			AccountID:  lastOrder.AccountID,
-			CreatedAt:  lastOrder.CreatedAt,
-			TotalPrice: lastOrder.TotalPrice,
-			Products:   lastOrder.Products,
+	defer rows.Close()
+
+	counts := map[string]uint64{}
+
+	for rows.Next() {
+		var accountID string
+		var count uint64
+
+		if err := rows.Scan(&accountID, &count); err != nil {
+			return nil, err
 		}
 
-		orders = append(orders, newOrder)
+		counts[accountID] = count
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return orders, nil
+	return counts, nil
+}
+
+func (r *dbRepository) PutCoupon(ctx context.Context, c Coupon) error {
+	currency := c.Amount.Currency
+
+	if currency == "" {
+		currency = c.MinOrderValue.Currency
+	}
+
+	var expiresAt *time.Time
+
+	if !c.ExpiresAt.IsZero() {
+		expiresAt = &c.ExpiresAt
+	}
+
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO coupons(code, kind, percent, amount, currency, product_id, buy_quantity, free_quantity, min_order_value, usage_limit, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, $10, $11)`,
+		c.Code,
+		c.Kind,
+		c.Percent,
+		c.Amount.Amount,
+		currency,
+		c.ProductID,
+		c.BuyQuantity,
+		c.FreeQuantity,
+		c.MinOrderValue.Amount,
+		c.UsageLimit,
+		expiresAt,
+	)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrCouponExists
+	}
+
+	return err
+}
+
+func (r *dbRepository) GetCoupon(ctx context.Context, code string) (*Coupon, error) {
+	c := &Coupon{}
+
+	var currency, productID sql.NullString
+	var expiresAt sql.NullTime
+
+	err := r.db.QueryRowContext(
+		ctx,
+		`SELECT code, kind, percent, amount, currency, product_id, buy_quantity, free_quantity, min_order_value, usage_limit, expires_at
+		FROM coupons WHERE code = $1`,
+		code,
+	).Scan(
+		&c.Code,
+		&c.Kind,
+		&c.Percent,
+		&c.Amount.Amount,
+		&currency,
+		&productID,
+		&c.BuyQuantity,
+		&c.FreeQuantity,
+		&c.MinOrderValue.Amount,
+		&c.UsageLimit,
+		&expiresAt,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCouponNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Amount.Amount != 0 {
+		c.Amount.Currency = currency.String
+	}
+
+	if c.MinOrderValue.Amount != 0 {
+		c.MinOrderValue.Currency = currency.String
+	}
+
+	c.ProductID = productID.String
+	c.ExpiresAt = expiresAt.Time
+
+	return c, nil
+}
+
+func (r *dbRepository) CountCouponUses(ctx context.Context, code, accountID string) (uint32, error) {
+	return countCouponUses(ctx, r.db, code, accountID)
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// countCouponUses counts the orders of the account the coupon was applied to.
+// Cancelled orders give their use back.
+func countCouponUses(ctx context.Context, q queryer, code, accountID string) (uint32, error) {
+	var count uint32
+
+	err := q.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM order_discounts d JOIN orders o ON (o.id = d.order_id)
+		WHERE d.coupon_code = $1 AND o.account_id = $2 AND o.status <> $3`,
+		code,
+		accountID,
+		StatusCancelled,
+	).Scan(&count)
+
+	return count, err
+}
+
+func (r *dbRepository) GetCartItems(ctx context.Context, accountID string) ([]CartItem, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT product_id, quantity, added_at FROM cart_items WHERE account_id = $1 ORDER BY added_at, product_id",
+		accountID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []CartItem{}
+
+	for rows.Next() {
+		item := CartItem{}
+
+		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.AddedAt); err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// PutCartItem adds the item to the cart or replaces the quantity of the
+// product already in it, keeping the time it was first added.
+func (r *dbRepository) PutCartItem(ctx context.Context, accountID string, item CartItem) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO cart_items(account_id, product_id, quantity, added_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id, product_id) DO UPDATE SET quantity = EXCLUDED.quantity`,
+		accountID,
+		item.ProductID,
+		item.Quantity,
+		item.AddedAt,
+	)
+
+	return err
+}
+
+func (r *dbRepository) DeleteCartItem(ctx context.Context, accountID, productID string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"DELETE FROM cart_items WHERE account_id = $1 AND product_id = $2",
+		accountID,
+		productID,
+	)
+
+	return err
+}
+
+// RemoveCartItems removes the items from the cart, except the ones whose
+// quantity has changed since, so a concurrent update isn't lost.
+func (r *dbRepository) RemoveCartItems(ctx context.Context, accountID string, items []CartItem) error {
+	productIDs := make([]string, 0, len(items))
+	quantities := make([]int64, 0, len(items))
+
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+		quantities = append(quantities, int64(item.Quantity))
+	}
+
+	_, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM cart_items c
+		USING unnest($2::text[], $3::int[]) AS removed(product_id, quantity)
+		WHERE c.account_id = $1 AND c.product_id = removed.product_id AND c.quantity = removed.quantity`,
+		accountID,
+		pq.Array(productIDs),
+		pq.Array(quantities),
+	)
+
+	return err
+}
+
+// StartPayment records a new payment of an order. It replaces a declined or
+// voided payment, but fails with ErrPaymentInProgress if the order has any
+// other payment, so an order can't be charged twice.
+func (r *dbRepository) StartPayment(ctx context.Context, p Payment) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO payments(order_id, provider, reference, status, amount, currency, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (order_id) DO UPDATE SET
+			provider = EXCLUDED.provider,
+			reference = EXCLUDED.reference,
+			status = EXCLUDED.status,
+			amount = EXCLUDED.amount,
+			currency = EXCLUDED.currency,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at
+		WHERE payments.status IN ('declined', 'voided')`,
+		p.OrderID,
+		p.Provider,
+		p.Reference,
+		p.Status,
+		p.Amount.Amount,
+		p.Amount.Currency,
+		p.CreatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrPaymentInProgress
+	}
+
+	return nil
+}
+
+func (r *dbRepository) UpdatePayment(ctx context.Context, orderID string, status PaymentStatus, reference string) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		"UPDATE payments SET status = $2, reference = $3, updated_at = NOW() WHERE order_id = $1",
+		orderID,
+		status,
+		reference,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// PutRefund records a pending refund of an order's payment. The payment is
+// locked while the refund is checked against the captured amount and the
+// quantities of the order's lines that haven't been refunded yet, so
+// concurrent refunds can't give back more than was paid.
+func (r *dbRepository) PutRefund(ctx context.Context, refund Refund) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		var captured int64
+		var status PaymentStatus
+
+		err := tx.QueryRowContext(
+			ctx,
+			"SELECT amount, status FROM payments WHERE order_id = $1 FOR UPDATE",
+			refund.OrderID,
+		).Scan(&captured, &status)
+
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && status != PaymentCaptured) {
+			return ErrNotRefundable
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var refunded int64
+
+		err = tx.QueryRowContext(
+			ctx,
+			"SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id = $1 AND status <> 'failed'",
+			refund.OrderID,
+		).Scan(&refunded)
+
+		if err != nil {
+			return err
+		}
+
+		if refunded+refund.Amount.Amount > captured {
+			return ErrRefundExceeded
+		}
+
+		for _, l := range refund.Lines {
+			var left int64
+
+			err = tx.QueryRowContext(
+				ctx,
+				`SELECT op.quantity - COALESCE((
+					SELECT SUM(rl.quantity)
+					FROM refund_lines rl JOIN refunds r ON(r.id = rl.refund_id)
+					WHERE r.order_id = op.order_id AND r.status <> 'failed' AND rl.product_id = op.product_id
+				), 0)
+				FROM order_products op
+				WHERE op.order_id = $1 AND op.product_id = $2`,
+				refund.OrderID,
+				l.ProductID,
+			).Scan(&left)
+
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidRefund
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if int64(l.Quantity) > left {
+				return ErrRefundExceeded
+			}
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO refunds(id, order_id, reference, status, amount, currency, reason, actor, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			refund.ID,
+			refund.OrderID,
+			refund.Reference,
+			refund.Status,
+			refund.Amount.Amount,
+			refund.Amount.Currency,
+			refund.Reason,
+			refund.Actor,
+			refund.CreatedAt,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		for _, l := range refund.Lines {
+			if _, err = tx.ExecContext(
+				ctx,
+				"INSERT INTO refund_lines(refund_id, product_id, quantity, amount) VALUES ($1, $2, $3, $4)",
+				refund.ID,
+				l.ProductID,
+				l.Quantity,
+				l.Amount.Amount,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *dbRepository) UpdateRefund(ctx context.Context, id string, status RefundStatus, reference string) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		"UPDATE refunds SET status = $2, reference = $3 WHERE id = $1",
+		id,
+		status,
+		reference,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// StockOperation is a change to the stock the catalog holds for an order.
+type StockOperation string
+
+const (
+	StockCommit  StockOperation = "commit"
+	StockRelease StockOperation = "release"
+)
+
+// StockFailure records a stock operation the catalog failed to apply for an
+// order. Stock operations aren't idempotent, so they aren't retried but
+// settled by hand.
+type StockFailure struct {
+	OrderID   string
+	Operation StockOperation
+	Error     string
+	FailedAt  time.Time
+}
+
+func (r *dbRepository) PutStockFailure(ctx context.Context, f StockFailure) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO stock_failures (order_id, operation, error, failed_at) VALUES ($1, $2, $3, $4)",
+		f.OrderID,
+		f.Operation,
+		f.Error,
+		f.FailedAt,
+	)
+
+	return err
 }
@@ -6,23 +6,55 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	"github.com/azizkhan030/go-grpc-graphql/account"
+	"github.com/azizkhan030/go-grpc-graphql/auth"
 	"github.com/azizkhan030/go-grpc-graphql/catalog"
+	"github.com/azizkhan030/go-grpc-graphql/money"
 	pb "github.com/azizkhan030/go-grpc-graphql/order/protos/gen"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
 	pb.UnimplementedOrderServiceServer
 	service       Service
+	tokens        *auth.TokenIssuer
 	accountClient *account.Client
 	catalogClient *catalog.Client
 }
 
-func ListenGRPC(s Service, accountURL, catalogURL string, port int) error {
-	accountClient, err := account.NewClient(catalogURL)
+// serviceName is the subject of the tokens the order service acts with
+// towards other services.
+const serviceName = "order"
+
+// stockTimeout bounds the stock calls made once an order was placed or
+// changed status. They run even if the request was cancelled, so the stock
+// isn't held forever.
+const stockTimeout = 10 * time.Second
+
+var policy = auth.Policy{
+	pb.OrderService_PostOrder_FullMethodName:            auth.RoleCustomer,
+	pb.OrderService_PreviewOrder_FullMethodName:         auth.RoleCustomer,
+	pb.OrderService_GetOrder_FullMethodName:             auth.RoleCustomer,
+	pb.OrderService_TransitionOrder_FullMethodName:      auth.RoleAdmin,
+	pb.OrderService_GetOrdersForAccount_FullMethodName:  auth.RoleCustomer,
+	pb.OrderService_GetOrdersForAccounts_FullMethodName: auth.RoleCustomer,
+	pb.OrderService_CreateCoupon_FullMethodName:         auth.RoleAdmin,
+	pb.OrderService_GetCart_FullMethodName:              auth.RoleCustomer,
+	pb.OrderService_AddToCart_FullMethodName:            auth.RoleCustomer,
+	pb.OrderService_UpdateCartItem_FullMethodName:       auth.RoleCustomer,
+	pb.OrderService_Checkout_FullMethodName:             auth.RoleCustomer,
+	pb.OrderService_PayOrder_FullMethodName:             auth.RoleCustomer,
+	pb.OrderService_CancelOrder_FullMethodName:          auth.RoleCustomer,
+	pb.OrderService_RefundOrderLines_FullMethodName:     auth.RoleAdmin,
+}
+
+func ListenGRPC(s Service, tokens *auth.TokenIssuer, accountURL, catalogURL string, port int) error {
+	accountClient, err := account.NewClient(accountURL)
 
 	if err != nil {
 		return err
@@ -43,11 +75,12 @@ func ListenGRPC(s Service, accountURL, catalogURL string, port int) error {
 		return err
 	}
 
-	serv := grpc.NewServer()
+	serv := grpc.NewServer(grpc.UnaryInterceptor(auth.UnaryServerInterceptor(tokens, policy)))
 
 	pb.RegisterOrderServiceServer(serv, &grpcServer{
 		pb.UnimplementedOrderServiceServer{},
 		s,
+		tokens,
 		accountClient,
 		catalogClient,
 	})
@@ -58,127 +91,1119 @@ func ListenGRPC(s Service, accountURL, catalogURL string, port int) error {
 }
 
 func (s *grpcServer) PostOrder(ctx context.Context, r *pb.PostOrderRequest) (*pb.PostOrderResponse, error) {
-	_, err := s.accountClient.GetAccount(ctx, r.AccountId)
+	if err := s.checkAccount(ctx, r.AccountId); err != nil {
+		return nil, err
+	}
+
+	requested := requestedProducts(r.Products)
+
+	if len(requested) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "order has no products")
+	}
+
+	address, err := requestedAddress(r.AccountId, r.AddressId, r.ShippingAddress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	checkout := Checkout{
+		Currency:        r.Currency,
+		Region:          r.Region,
+		CouponCode:      r.CouponCode,
+		ShippingAddress: address,
+	}
+
+	if r.IdempotencyKey != "" {
+		o, err := s.service.GetIdempotentOrder(ctx, r.AccountId, r.IdempotencyKey, checkout, requested)
+
+		if !errors.Is(err, ErrNotFound) {
+			return s.postOrderResponse(ctx, o, err)
+		}
+	}
+
+	if checkout.ShippingAddress, err = s.savedAddress(ctx, r.AccountId, address); err != nil {
+		return nil, err
+	}
+
+	products, err := s.priceProducts(ctx, requested, r.Currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	items := stockItems(products)
+	stockCtx, err := s.tokens.ServiceContext(ctx, serviceName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.catalogClient.ReserveStock(stockCtx, items); err != nil {
+		log.Println("Error reserving stock:", err)
+		return nil, err
+	}
+
+	order, err := s.service.PostOrder(ctx, r.AccountId, r.IdempotencyKey, checkout, products)
+
+	if err != nil {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(stockCtx), stockTimeout)
+
+		if releaseErr := s.catalogClient.ReleaseStock(releaseCtx, items); releaseErr != nil {
+			log.Println("Error releasing stock:", releaseErr)
+		}
+
+		cancel()
+	}
+
+	// A concurrent request with the same key placed the order first
+	if errors.Is(err, ErrDuplicateOrder) {
+		order, err = s.service.GetIdempotentOrder(ctx, r.AccountId, r.IdempotencyKey, checkout, requested)
+	}
+
+	return s.postOrderResponse(ctx, order, err)
+}
+
+func (s *grpcServer) postOrderResponse(ctx context.Context, o *Order, err error) (*pb.PostOrderResponse, error) {
+	if err != nil {
+		return nil, orderError(err)
+	}
+
+	products := s.productDetails(ctx, []Order{*o})
+
+	return &pb.PostOrderResponse{
+		Order: orderOut(*o, products),
+	}, nil
+}
+
+func (s *grpcServer) PreviewOrder(ctx context.Context, r *pb.PreviewOrderRequest) (*pb.PreviewOrderResponse, error) {
+	if err := s.checkAccount(ctx, r.AccountId); err != nil {
+		return nil, err
+	}
+
+	requested := requestedProducts(r.Products)
+
+	if len(requested) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "order has no products")
+	}
+
+	address, err := s.shippingAddress(ctx, r.AccountId, r.AddressId, r.ShippingAddress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := s.priceProducts(ctx, requested, r.Currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := s.service.PreviewOrder(ctx, r.AccountId, Checkout{
+		Currency:        r.Currency,
+		Region:          r.Region,
+		CouponCode:      r.CouponCode,
+		ShippingAddress: address,
+	}, products)
+
+	if err != nil {
+		return nil, orderError(err)
+	}
+
+	return &pb.PreviewOrderResponse{
+		Order: orderOut(*o, nil),
+	}, nil
+}
+
+// orderError maps the errors of placing or previewing an order.
+func orderError(err error) error {
+	switch {
+	case errors.Is(err, ErrIdempotencyConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, money.ErrCurrencyMismatch),
+		errors.Is(err, money.ErrOverflow),
+		errors.Is(err, ErrCouponNotFound),
+		errors.Is(err, ErrUnknownTaxRegion),
+		errors.Is(err, ErrMissingTaxRegion):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrCouponExpired),
+		errors.Is(err, ErrCouponUsageLimit),
+		errors.Is(err, ErrCouponNotApplicable):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	log.Println("Error posting order:", err)
+	return errors.New("could not post the order")
+}
+
+// checkAccount makes sure the caller may order for the account and that the
+// account still exists.
+func (s *grpcServer) checkAccount(ctx context.Context, accountID string) error {
+	if !auth.CanActFor(ctx, accountID) {
+		return status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	acc, err := s.accountClient.GetAccount(ctx, accountID)
 	if err != nil {
 		log.Println("Error getting account:", err)
-		return nil, errors.New("account not found")
+		return errors.New("account not found")
+	}
+
+	if acc.Deleted {
+		return errors.New("account not found")
 	}
 
+	return nil
+}
+
+// shippingAddress returns the saved address with the given ID, which must
+// belong to the account, or else the inline address, if any.
+func (s *grpcServer) shippingAddress(ctx context.Context, accountID, addressID string, inline *pb.Order_ShippingAddress) (*account.Address, error) {
+	a, err := requestedAddress(accountID, addressID, inline)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.savedAddress(ctx, accountID, a)
+}
+
+// savedAddress looks up a saved address requested by its ID, which must
+// belong to the account. Other addresses are returned as they are.
+func (s *grpcServer) savedAddress(ctx context.Context, accountID string, requested *account.Address) (*account.Address, error) {
+	if requested == nil || requested.ID == "" {
+		return requested, nil
+	}
+
+	a, err := s.accountClient.GetAddress(ctx, requested.ID)
+
+	if code := status.Code(err); code == codes.NotFound || (err == nil && a.AccountID != accountID) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("address %s not found", requested.ID))
+	}
+
+	if err != nil {
+		log.Println("Error getting address:", err)
+		return nil, errors.New("could not get the address")
+	}
+
+	return a, nil
+}
+
+// requestedAddress returns the address an order request ships to without
+// looking it up: only the ID of a saved address, or else the validated
+// inline address, if any.
+func requestedAddress(accountID, addressID string, inline *pb.Order_ShippingAddress) (*account.Address, error) {
+	if addressID != "" {
+		return &account.Address{ID: addressID}, nil
+	}
+
+	if inline == nil {
+		return nil, nil
+	}
+
+	a := addressIn(inline)
+	a.ID = ""
+	a.AccountID = accountID
+	a.Normalize()
+
+	if err := a.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &a, nil
+}
+
+// priceProducts looks up the requested products in the catalog and prices
+// them in the currency.
+func (s *grpcServer) priceProducts(ctx context.Context, requested []OrderedProduct, currency string) ([]OrderedProduct, error) {
 	productIDs := []string{}
-	orderedProducts, err := s.catalogClient.GetProducts(ctx, "", productIDs, 0, 0)
+
+	for _, p := range requested {
+		productIDs = append(productIDs, p.ID)
+	}
+
+	productPage, err := s.catalogClient.GetProducts(ctx, "", productIDs, 0, 0, "", currency)
+
+	// The requested currency is invalid or can't be converted to
+	if code := status.Code(err); code == codes.InvalidArgument || code == codes.FailedPrecondition {
+		return nil, err
+	}
 
 	if err != nil {
 		log.Println("Error getting products: ", err)
 		return nil, errors.New("products not found")
 	}
+
+	details := map[string]catalog.Product{}
+	for _, p := range productPage.Products {
+		details[p.ID] = p
+	}
+
 	products := []OrderedProduct{}
-	for _, p := range orderedProducts {
-		product := OrderedProduct{
-			ID:          p.ID,
-			Quantity:    0,
-			Price:       p.Price,
-			Name:        p.Name,
-			Description: p.Description,
-		}
-
-		for _, rp := range r.Products {
-			if rp.ProductId == p.ID {
-				product.Quantity = rp.Quantity
-				break
-			}
+	for _, rp := range requested {
+		p, ok := details[rp.ID]
+
+		if !ok {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("product %s not found", rp.ID))
 		}
 
-		if product.Quantity != 0 {
-			products = append(products, product)
+		products = append(products, OrderedProduct{
+			ID:           p.ID,
+			Quantity:     rp.Quantity,
+			Price:        p.Price,
+			ExchangeRate: p.ExchangeRate,
+			TaxCategory:  p.TaxCategory,
+			Name:         p.Name,
+			Description:  p.Description,
+		})
+	}
+
+	return products, nil
+}
+
+// requestedProducts merges the products of an order request by ID, dropping
+// the ones with no quantity.
+func requestedProducts(in []*pb.PostOrderRequest_OrderProduct) []OrderedProduct {
+	products := []OrderedProduct{}
+	index := map[string]int{}
+
+	for _, rp := range in {
+		if rp.Quantity == 0 {
+			continue
+		}
+
+		if i, ok := index[rp.ProductId]; ok {
+			products[i].Quantity = addQuantities(products[i].Quantity, rp.Quantity)
+			continue
 		}
+
+		index[rp.ProductId] = len(products)
+		products = append(products, OrderedProduct{ID: rp.ProductId, Quantity: rp.Quantity})
+	}
+
+	return products
+}
+
+func stockItems(products []OrderedProduct) []catalog.StockItem {
+	items := make([]catalog.StockItem, 0, len(products))
+
+	for _, p := range products {
+		items = append(items, catalog.StockItem{ProductID: p.ID, Quantity: p.Quantity})
+	}
+
+	return items
+}
+
+func (s *grpcServer) GetOrder(ctx context.Context, r *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
+	o, err := s.service.GetOrder(ctx, r.Id)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
 	}
-	order, err := s.service.PostOrder(ctx, r.AccountId, products)
 
 	if err != nil {
-		log.Println("Error posting order:", err)
-		return nil, errors.New("could not post the order")
+		log.Println(err)
+		return nil, err
 	}
 
-	orderProto := &pb.Order{
-		Id:         order.ID,
-		AccountId:  order.AccountID,
-		TotalPrice: order.TotalPrice,
-		Products:   []*pb.Order_OrderProduct{},
+	// Respond with NotFound rather than PermissionDenied, so order IDs of
+	// other accounts can't be probed
+	if !auth.CanActFor(ctx, o.AccountID) {
+		return nil, status.Error(codes.NotFound, ErrNotFound.Error())
 	}
 
-	orderProto.CreatedAt, _ = order.CreatedAt.MarshalBinary()
-	for _, p := range order.Products {
-		orderProto.Products = append(orderProto.Products, &pb.Order_OrderProduct{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    p.Quantity,
-		})
+	products := s.productDetails(ctx, []Order{*o})
+
+	return &pb.GetOrderResponse{
+		Order: orderOut(*o, products),
+	}, nil
+}
+
+func (s *grpcServer) TransitionOrder(ctx context.Context, r *pb.TransitionOrderRequest) (*pb.TransitionOrderResponse, error) {
+	to, err := ParseStatus(r.Status)
+
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	return &pb.PostOrderResponse{
-		Order: orderProto,
+	claims, _ := auth.ClaimsFromContext(ctx)
+	o, err := s.service.TransitionOrder(ctx, r.Id, to, claims.AccountID())
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidTransition):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		log.Println(err)
+		return nil, err
+	}
+
+	if err = s.settleStock(ctx, *o); err != nil {
+		log.Println("Error settling stock:", err)
+	}
+
+	products := s.productDetails(ctx, []Order{*o})
+
+	return &pb.TransitionOrderResponse{
+		Order: orderOut(*o, products),
+	}, nil
+}
+
+func (s *grpcServer) PayOrder(ctx context.Context, r *pb.PayOrderRequest) (*pb.PayOrderResponse, error) {
+	if r.PaymentToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "payment token is required")
+	}
+
+	o, err := s.service.GetOrder(ctx, r.Id)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	if !auth.CanActFor(ctx, o.AccountID) {
+		return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+	}
+
+	claims, _ := auth.ClaimsFromContext(ctx)
+	o, err = s.service.PayOrder(ctx, r.Id, r.PaymentToken, claims.AccountID())
+
+	switch {
+	case errors.Is(err, ErrInvalidTransition),
+		errors.Is(err, ErrPaymentDeclined),
+		errors.Is(err, ErrPaymentFailed):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrPaymentInProgress):
+		return nil, status.Error(codes.Aborted, err.Error())
+	case err != nil:
+		log.Println(err)
+		return nil, err
+	}
+
+	products := s.productDetails(ctx, []Order{*o})
+
+	return &pb.PayOrderResponse{
+		Order: orderOut(*o, products),
+	}, nil
+}
+
+// CancelOrder lets customers cancel their own orders. The stock reserved for
+// the order is released once it's cancelled.
+func (s *grpcServer) CancelOrder(ctx context.Context, r *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
+	if r.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "reason is required")
+	}
+
+	o, err := s.service.GetOrder(ctx, r.Id)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	if !auth.CanActFor(ctx, o.AccountID) {
+		return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+	}
+
+	claims, _ := auth.ClaimsFromContext(ctx)
+	o, err = s.service.CancelOrder(ctx, r.Id, r.Reason, claims.AccountID())
+
+	if err != nil {
+		return nil, refundError(err)
+	}
+
+	if err = s.settleStock(ctx, *o); err != nil {
+		log.Println("Error settling stock:", err)
+	}
+
+	products := s.productDetails(ctx, []Order{*o})
+
+	return &pb.CancelOrderResponse{
+		Order: orderOut(*o, products),
+	}, nil
+}
+
+func (s *grpcServer) RefundOrderLines(ctx context.Context, r *pb.RefundOrderLinesRequest) (*pb.RefundOrderLinesResponse, error) {
+	if r.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "reason is required")
+	}
+
+	lines := []RefundLine{}
+
+	for _, l := range r.Lines {
+		lines = append(lines, RefundLine{ProductID: l.ProductId, Quantity: l.Quantity})
+	}
+
+	claims, _ := auth.ClaimsFromContext(ctx)
+	o, err := s.service.RefundOrderLines(ctx, r.Id, lines, r.Reason, claims.AccountID())
+
+	if err != nil {
+		return nil, refundError(err)
+	}
+
+	products := s.productDetails(ctx, []Order{*o})
+
+	return &pb.RefundOrderLinesResponse{
+		Order: orderOut(*o, products),
 	}, nil
 }
 
+// refundError maps the errors of cancelling or refunding an order.
+func refundError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidRefund):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrInvalidTransition),
+		errors.Is(err, ErrNotRefundable),
+		errors.Is(err, ErrRefundExceeded),
+		errors.Is(err, ErrRefundFailed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	log.Println(err)
+	return err
+}
+
 func (s *grpcServer) GetOrdersForAccount(ctx context.Context, r *pb.GetOrderForAccountRequest) (*pb.GetOrdersForAccountResponse, error) {
-	accountOrders, err := s.service.GetOrdersForAccount(ctx, r.AccountId)
+	if !auth.CanActFor(ctx, r.AccountId) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	filter, err := filterIn(r.Filter)
+
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	page, err := s.service.GetOrdersForAccount(ctx, r.AccountId, filter)
+
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	products := s.productDetails(ctx, page.Orders)
+
+	orders := []*pb.Order{}
+	for _, o := range page.Orders {
+		orders = append(orders, orderOut(o, products))
+	}
+	return &pb.GetOrdersForAccountResponse{
+		Orders:     orders,
+		TotalCount: page.TotalCount,
+		Cursors:    page.Cursors,
+		NextCursor: page.NextCursor,
+	}, nil
+}
+
+func (s *grpcServer) GetOrdersForAccounts(ctx context.Context, r *pb.GetOrdersForAccountsRequest) (*pb.GetOrdersForAccountsResponse, error) {
+	for _, id := range r.AccountIds {
+		if !auth.CanActFor(ctx, id) {
+			return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+		}
+	}
+
+	filter, err := filterIn(r.Filter)
+
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	pages, err := s.service.GetOrdersForAccounts(ctx, r.AccountIds, filter)
+
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	allOrders := []Order{}
+
+	for _, page := range pages {
+		allOrders = append(allOrders, page.Orders...)
+	}
+
+	products := s.productDetails(ctx, allOrders)
+
+	res := &pb.GetOrdersForAccountsResponse{}
+
+	for _, id := range r.AccountIds {
+		page := pages[id]
+		accountOrders := &pb.GetOrdersForAccountsResponse_AccountOrders{
+			AccountId:  id,
+			Orders:     []*pb.Order{},
+			TotalCount: page.TotalCount,
+			Cursors:    page.Cursors,
+			NextCursor: page.NextCursor,
+		}
+
+		for _, o := range page.Orders {
+			accountOrders.Orders = append(accountOrders.Orders, orderOut(o, products))
+		}
+
+		res.Accounts = append(res.Accounts, accountOrders)
+	}
+
+	return res, nil
+}
+
+// listError maps the errors of listing orders.
+func listError(err error) error {
+	if errors.Is(err, ErrInvalidFilter) || errors.Is(err, ErrInvalidCursor) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	log.Println(err)
+	return err
+}
+
+// filterIn reads a filter, failing with ErrInvalidFilter on a malformed
+// creation time bound rather than dropping it.
+func filterIn(f *pb.OrderFilter) (OrderFilter, error) {
+	if f == nil {
+		return OrderFilter{}, nil
+	}
+
+	filter := OrderFilter{
+		ProductIDs: f.ProductIds,
+		Sort:       OrderSort(f.Sort),
+		Skip:       f.Skip,
+		Take:       f.Take,
+		Cursor:     f.Cursor,
+	}
+
+	for _, s := range f.Statuses {
+		filter.Statuses = append(filter.Statuses, Status(s))
+	}
+
+	if f.MinTotal != nil {
+		filter.MinTotal = money.FromProto(f.MinTotal)
+	}
+
+	if f.MaxTotal != nil {
+		filter.MaxTotal = money.FromProto(f.MaxTotal)
+	}
+
+	if len(f.CreatedFrom) > 0 {
+		if err := filter.CreatedFrom.UnmarshalBinary(f.CreatedFrom); err != nil {
+			return filter, fmt.Errorf("%w: createdFrom: %v", ErrInvalidFilter, err)
+		}
+	}
+
+	if len(f.CreatedTo) > 0 {
+		if err := filter.CreatedTo.UnmarshalBinary(f.CreatedTo); err != nil {
+			return filter, fmt.Errorf("%w: createdTo: %v", ErrInvalidFilter, err)
+		}
+	}
+
+	return filter, nil
+}
+
+func filterOut(f OrderFilter) *pb.OrderFilter {
+	filter := &pb.OrderFilter{
+		ProductIds: f.ProductIDs,
+		Sort:       string(f.Sort),
+		Skip:       f.Skip,
+		Take:       f.Take,
+		Cursor:     f.Cursor,
+	}
+
+	for _, s := range f.Statuses {
+		filter.Statuses = append(filter.Statuses, string(s))
+	}
+
+	if f.MinTotal.Currency != "" {
+		filter.MinTotal = f.MinTotal.Proto()
+	}
+
+	if f.MaxTotal.Currency != "" {
+		filter.MaxTotal = f.MaxTotal.Proto()
+	}
+
+	if !f.CreatedFrom.IsZero() {
+		filter.CreatedFrom, _ = f.CreatedFrom.MarshalBinary()
+	}
+
+	if !f.CreatedTo.IsZero() {
+		filter.CreatedTo, _ = f.CreatedTo.MarshalBinary()
+	}
+
+	return filter
+}
+
+func (s *grpcServer) CreateCoupon(ctx context.Context, r *pb.CreateCouponRequest) (*pb.CreateCouponResponse, error) {
+	if r.Coupon == nil {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidCoupon.Error())
+	}
+
+	c, err := s.service.CreateCoupon(ctx, CouponFromProto(r.Coupon))
+
+	switch {
+	case errors.Is(err, ErrInvalidCoupon):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrCouponExists):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case err != nil:
+		log.Println(err)
+		return nil, err
+	}
+
+	return &pb.CreateCouponResponse{
+		Coupon: c.Proto(),
+	}, nil
+}
+
+func (s *grpcServer) GetCart(ctx context.Context, r *pb.GetCartRequest) (*pb.GetCartResponse, error) {
+	if !auth.CanActFor(ctx, r.AccountId) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	cart, err := s.pricedCart(ctx, r.AccountId, r.Currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetCartResponse{Cart: cartOut(*cart)}, nil
+}
+
+func (s *grpcServer) AddToCart(ctx context.Context, r *pb.AddToCartRequest) (*pb.AddToCartResponse, error) {
+	if !auth.CanActFor(ctx, r.AccountId) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	if r.Quantity == 0 {
+		return nil, status.Error(codes.InvalidArgument, "quantity must be positive")
+	}
+
+	cart, err := s.service.GetCart(ctx, r.AccountId)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	if err = s.setCartItem(ctx, r.AccountId, r.ProductId, addQuantities(cart.quantity(r.ProductId), r.Quantity)); err != nil {
+		return nil, err
+	}
+
+	priced, err := s.pricedCart(ctx, r.AccountId, r.Currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.AddToCartResponse{Cart: cartOut(*priced)}, nil
+}
+
+func (s *grpcServer) UpdateCartItem(ctx context.Context, r *pb.UpdateCartItemRequest) (*pb.UpdateCartItemResponse, error) {
+	if !auth.CanActFor(ctx, r.AccountId) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	if err := s.setCartItem(ctx, r.AccountId, r.ProductId, r.Quantity); err != nil {
+		return nil, err
+	}
+
+	cart, err := s.pricedCart(ctx, r.AccountId, r.Currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateCartItemResponse{Cart: cartOut(*cart)}, nil
+}
+
+// setCartItem checks the quantity against the product's stock in the catalog
+// before storing it.
+func (s *grpcServer) setCartItem(ctx context.Context, accountID, productID string, quantity uint32) error {
+	if quantity > 0 {
+		p, err := s.catalogClient.GetProduct(ctx, productID, "")
+
+		if status.Code(err) == codes.NotFound {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("product %s not found", productID))
+		}
+
+		if err != nil {
+			log.Println("Error getting product:", err)
+			return errors.New("could not get the product")
+		}
+
+		if quantity > p.Stock {
+			return status.Error(codes.FailedPrecondition, fmt.Sprintf("only %d of product %s in stock", p.Stock, productID))
+		}
+	}
+
+	err := s.service.SetCartItem(ctx, accountID, productID, quantity)
+
+	if errors.Is(err, ErrCartFull) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	return err
+}
+
+// Checkout places an order for the items in the cart, which are then removed
+// from it.
+func (s *grpcServer) Checkout(ctx context.Context, r *pb.CheckoutRequest) (*pb.CheckoutResponse, error) {
+	if !auth.CanActFor(ctx, r.AccountId) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	cart, err := s.service.GetCart(ctx, r.AccountId)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	// The cart of a checkout that went through is cleared, so a retry
+	// returns the order it placed rather than failing on the empty cart
+	if len(cart.Items) == 0 && r.IdempotencyKey != "" {
+		o, err := s.service.GetOrderByIdempotencyKey(ctx, r.AccountId, r.IdempotencyKey)
+
+		if !errors.Is(err, ErrNotFound) {
+			res, err := s.postOrderResponse(ctx, o, err)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return &pb.CheckoutResponse{Order: res.Order}, nil
+		}
+	}
+
+	if len(cart.Items) == 0 {
+		return nil, status.Error(codes.FailedPrecondition, ErrCartEmpty.Error())
+	}
+
+	req := &pb.PostOrderRequest{
+		AccountId:       r.AccountId,
+		IdempotencyKey:  r.IdempotencyKey,
+		Currency:        r.Currency,
+		CouponCode:      r.CouponCode,
+		Region:          r.Region,
+		AddressId:       r.AddressId,
+		ShippingAddress: r.ShippingAddress,
+	}
+
+	for _, item := range cart.Items {
+		req.Products = append(req.Products, &pb.PostOrderRequest_OrderProduct{
+			ProductId: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	res, err := s.PostOrder(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The order is placed already, so a failure here is only logged
+	if err = s.service.RemoveCartItems(ctx, r.AccountId, cart.Items); err != nil {
+		log.Println("Error clearing cart:", err)
+	}
+
+	return &pb.CheckoutResponse{Order: res.Order}, nil
+}
+
+// pricedCart returns the account's cart with the catalog details of its
+// items, priced in the currency.
+func (s *grpcServer) pricedCart(ctx context.Context, accountID, currency string) (*Cart, error) {
+	cart, err := s.service.GetCart(ctx, accountID)
 
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
+	cart.Subtotal = money.New(0, currency)
+
+	if len(cart.Items) == 0 {
+		return cart, nil
+	}
+
+	productIDs := []string{}
+
+	for _, item := range cart.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	productPage, err := s.catalogClient.GetProducts(ctx, "", productIDs, 0, 0, "", currency)
+
+	// The requested currency is invalid or can't be converted to
+	if code := status.Code(err); code == codes.InvalidArgument || code == codes.FailedPrecondition {
+		return nil, err
+	}
+
+	if err != nil {
+		log.Println("Error getting products: ", err)
+		return nil, errors.New("products not found")
+	}
+
+	details := map[string]catalog.Product{}
+	for _, p := range productPage.Products {
+		details[p.ID] = p
+	}
+
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		p, ok := details[item.ProductID]
+
+		if !ok {
+			continue
+		}
+
+		item.Name = p.Name
+		item.Price = p.Price
+		item.ExchangeRate = p.ExchangeRate
+		item.Available = item.Quantity <= p.Stock
+
+		if !item.Available {
+			continue
+		}
+
+		line, err := p.Price.Mul(int64(item.Quantity))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cart.Subtotal, err = cart.Subtotal.Add(line); err != nil {
+			return nil, err
+		}
+	}
+
+	return cart, nil
+}
+
+func cartOut(c Cart) *pb.Cart {
+	out := &pb.Cart{
+		AccountId: c.AccountID,
+		Items:     []*pb.Cart_Item{},
+		Subtotal:  c.Subtotal.Proto(),
+	}
+
+	for _, item := range c.Items {
+		i := &pb.Cart_Item{
+			ProductId:    item.ProductID,
+			Quantity:     item.Quantity,
+			Name:         item.Name,
+			Price:        item.Price.Proto(),
+			ExchangeRate: item.ExchangeRate,
+			Available:    item.Available,
+		}
+		i.AddedAt, _ = item.AddedAt.MarshalBinary()
+
+		out.Items = append(out.Items, i)
+	}
+
+	return out
+}
+
+// settleStock finalizes the stock reserved for an order once it ships, or
+// returns it to the catalog if the order ends without shipping. The order has
+// changed status already, so a failure is recorded to be settled by hand.
+func (s *grpcServer) settleStock(ctx context.Context, o Order) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stockTimeout)
+	defer cancel()
+
+	op := StockCommit
+
+	switch {
+	case o.Status == StatusFulfilled:
+	case (o.Status == StatusCancelled || o.Status == StatusRefunded) && !o.wasFulfilled():
+		op = StockRelease
+	default:
+		return nil
+	}
+
+	err := s.applyStock(ctx, op, stockItems(o.Products))
+
+	if err != nil {
+		if recordErr := s.service.RecordStockFailure(ctx, o.ID, op, err); recordErr != nil {
+			log.Println("Error recording stock failure:", recordErr)
+		}
+	}
+
+	return err
+}
+
+func (s *grpcServer) applyStock(ctx context.Context, op StockOperation, items []catalog.StockItem) error {
+	ctx, err := s.tokens.ServiceContext(ctx, serviceName)
+
+	if err != nil {
+		return err
+	}
+
+	if op == StockCommit {
+		return s.catalogClient.CommitStock(ctx, items)
+	}
+
+	return s.catalogClient.ReleaseStock(ctx, items)
+}
+
+// productDetails looks up the catalog details of every product in the given
+// orders with a single catalog call. Orders carry a snapshot of everything
+// but the descriptions, so a failed lookup is logged rather than returned.
+func (s *grpcServer) productDetails(ctx context.Context, orders []Order) map[string]catalog.Product {
 	productIDMap := map[string]bool{}
 
-	for _, o := range accountOrders {
+	for _, o := range orders {
 		for _, p := range o.Products {
 			productIDMap[p.ID] = true
 		}
 	}
+
+	details := map[string]catalog.Product{}
+
+	if len(productIDMap) == 0 {
+		return details
+	}
+
 	productIDs := []string{}
 
 	for id := range productIDMap {
 		productIDs = append(productIDs, id)
 	}
-	products, err := s.catalogClient.GetProducts(ctx, "", productIDs, 0, 0)
+
+	productPage, err := s.catalogClient.GetProducts(ctx, "", productIDs, 0, 0, "", "")
 
 	if err != nil {
-		log.Println("Error getting account products: ", err)
-		return nil, err
+		log.Println("Error getting order products: ", err)
+		return details
 	}
 
-	orders := []*pb.Order{}
-	for _, o := range accountOrders {
-		op := &pb.Order{
-			AccountId:  o.AccountID,
-			Id:         o.ID,
-			TotalPrice: o.TotalPrice,
-			Products:   []*pb.Order_OrderProduct{},
-		}
-		op.CreatedAt, _ = o.CreatedAt.MarshalBinary()
-
-		for _, product := range o.Products {
-			for _, p := range products {
-				if p.ID == product.ID {
-					product.Name = p.Name
-					product.Description = p.Description
-					product.Price = p.Price
-					break
-				}
-			}
-			op.Products = append(op.Products, &pb.Order_OrderProduct{
-				Id:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				Quantity:    product.Quantity,
+	for _, p := range productPage.Products {
+		details[p.ID] = p
+	}
+
+	return details
+}
+
+func orderOut(o Order, products map[string]catalog.Product) *pb.Order {
+	op := &pb.Order{
+		AccountId:  o.AccountID,
+		Id:         o.ID,
+		Subtotal:   o.Subtotal.Proto(),
+		Tax:        o.Tax.Proto(),
+		TotalPrice: o.TotalPrice.Proto(),
+		TaxRegion:  o.TaxRegion,
+		Status:     string(o.Status),
+		Products:   []*pb.Order_OrderProduct{},
+	}
+	op.CreatedAt, _ = o.CreatedAt.MarshalBinary()
+
+	if o.ShippingAddress != nil {
+		op.ShippingAddress = addressOut(*o.ShippingAddress)
+	}
+
+	if p := o.Payment; p != nil {
+		op.Payment = &pb.Order_Payment{
+			Provider:  p.Provider,
+			Reference: p.Reference,
+			Status:    string(p.Status),
+			Amount:    p.Amount.Proto(),
+		}
+		op.Payment.CreatedAt, _ = p.CreatedAt.MarshalBinary()
+		op.Payment.UpdatedAt, _ = p.UpdatedAt.MarshalBinary()
+	}
+
+	for _, r := range o.Refunds {
+		refund := &pb.Order_Refund{
+			Id:        r.ID,
+			Reference: r.Reference,
+			Status:    string(r.Status),
+			Amount:    r.Amount.Proto(),
+			Reason:    r.Reason,
+			Actor:     r.Actor,
+		}
+		refund.CreatedAt, _ = r.CreatedAt.MarshalBinary()
+
+		for _, l := range r.Lines {
+			refund.Lines = append(refund.Lines, &pb.Order_Refund_Line{
+				ProductId: l.ProductID,
+				Quantity:  l.Quantity,
+				Amount:    l.Amount.Proto(),
 			})
 		}
-		orders = append(orders, op)
+
+		op.Refunds = append(op.Refunds, refund)
+	}
+
+	for _, d := range o.Discounts {
+		op.Discounts = append(op.Discounts, &pb.Order_Discount{
+			CouponCode:  d.CouponCode,
+			Description: d.Description,
+			Amount:      d.Amount.Proto(),
+		})
+	}
+
+	for _, c := range o.StatusHistory {
+		change := &pb.Order_StatusChange{
+			Status: string(c.Status),
+			Actor:  c.Actor,
+			Reason: c.Reason,
+		}
+		change.ChangedAt, _ = c.ChangedAt.MarshalBinary()
+		op.StatusHistory = append(op.StatusHistory, change)
+	}
+
+	for _, product := range o.Products {
+		if p, ok := products[product.ID]; ok {
+			product.Description = p.Description
+		}
+
+		op.Products = append(op.Products, &pb.Order_OrderProduct{
+			Id:           product.ID,
+			Name:         product.Name,
+			Description:  product.Description,
+			Price:        product.Price.Proto(),
+			ExchangeRate: product.ExchangeRate,
+			TaxCategory:  product.TaxCategory,
+			Tax:          product.Tax.Proto(),
+			Quantity:     product.Quantity,
+		})
+	}
+
+	return op
+}
+
+func addressIn(a *pb.Order_ShippingAddress) account.Address {
+	return account.Address{
+		ID:         a.AddressId,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func addressOut(a account.Address) *pb.Order_ShippingAddress {
+	return &pb.Order_ShippingAddress{
+		AddressId:  a.ID,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
 	}
-	return &pb.GetOrdersForAccountResponse{
-		Orders: orders,
-	}, nil
 }
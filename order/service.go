@@ -2,46 +2,743 @@ package order
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
 	"time"
 
+	"github.com/azizkhan030/go-grpc-graphql/account"
+	"github.com/azizkhan030/go-grpc-graphql/money"
 	"github.com/segmentio/ksuid"
 )
 
+var (
+	ErrIdempotencyConflict = errors.New("idempotency key was already used with a different payload")
+	ErrDuplicateOrder      = errors.New("an order was already placed with this idempotency key")
+)
+
 type Service interface {
-	PostOrder(ctx context.Context, accountID string, products []OrderedProduct) (*Order, error)
-	GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error)
+	PostOrder(ctx context.Context, accountID, idempotencyKey string, c Checkout, products []OrderedProduct) (*Order, error)
+	PreviewOrder(ctx context.Context, accountID string, c Checkout, products []OrderedProduct) (*Order, error)
+	GetIdempotentOrder(ctx context.Context, accountID, idempotencyKey string, c Checkout, products []OrderedProduct) (*Order, error)
+	GetOrderByIdempotencyKey(ctx context.Context, accountID, idempotencyKey string) (*Order, error)
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	TransitionOrder(ctx context.Context, id string, to Status, actor string) (*Order, error)
+	GetOrdersForAccount(ctx context.Context, accountID string, f OrderFilter) (*OrderPage, error)
+	GetOrdersForAccounts(ctx context.Context, accountIDs []string, f OrderFilter) (map[string]*OrderPage, error)
+	CreateCoupon(ctx context.Context, c Coupon) (*Coupon, error)
+	GetCart(ctx context.Context, accountID string) (*Cart, error)
+	SetCartItem(ctx context.Context, accountID, productID string, quantity uint32) error
+	RemoveCartItems(ctx context.Context, accountID string, items []CartItem) error
+	PayOrder(ctx context.Context, id, token, actor string) (*Order, error)
+	CancelOrder(ctx context.Context, id, reason, actor string) (*Order, error)
+	RefundOrderLines(ctx context.Context, id string, lines []RefundLine, reason, actor string) (*Order, error)
+	RecordStockFailure(ctx context.Context, orderID string, op StockOperation, cause error) error
+}
+
+// Checkout holds the options an order is placed with. Currency is the one the
+// products were priced in. Orders with a shipping address are taxed in its
+// region, other orders in Region, if any.
+type Checkout struct {
+	Currency        string
+	Region          string
+	CouponCode      string
+	ShippingAddress *account.Address
+}
+
+func (c Checkout) taxRegion() string {
+	if c.ShippingAddress != nil {
+		return c.ShippingAddress.TaxRegion()
+	}
+
+	return c.Region
+}
+
+// OrderPage is a single page of an account's orders. Cursors holds the
+// cursor of each order, in the same order.
+type OrderPage struct {
+	Orders     []Order
+	Cursors    []string
+	NextCursor string
+	TotalCount uint64
 }
 
 type orderService struct {
 	repository Repository
+	tax        TaxCalculator
+	taxPolicy  TaxPolicy
+	payments   PaymentProvider
 }
 
-func NewService(r Repository) Service {
-	return &orderService{r}
+func NewService(r Repository, t TaxCalculator, tp TaxPolicy, p PaymentProvider) Service {
+	return &orderService{r, t, tp, p}
 }
 
-func (s orderService) PostOrder(ctx context.Context, accountID string, products []OrderedProduct) (*Order, error) {
+// PostOrder places a new order. The products must already be priced in the
+// requested currency. If the account already placed an order with the same
+// idempotency key, ErrDuplicateOrder is returned and the earlier order can
+// be fetched with GetIdempotentOrder.
+func (s orderService) PostOrder(ctx context.Context, accountID, idempotencyKey string, c Checkout, products []OrderedProduct) (*Order, error) {
+	o, err := s.PreviewOrder(ctx, accountID, c, products)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o.ID = ksuid.New().String()
+	o.Status = StatusPending
+	o.StatusHistory = []StatusChange{{
+		Status:    o.Status,
+		ChangedAt: o.CreatedAt,
+		Actor:     accountID,
+	}}
+
+	err = s.repository.PutOrder(ctx, *o, idempotencyKey, payloadFingerprint(c, products))
+
+	if errors.Is(err, errDuplicateIdempotencyKey) {
+		return nil, ErrDuplicateOrder
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// PreviewOrder prices the products, applies the coupon, if any, and adds the
+// tax of the region without placing the order. The returned order has no ID.
+func (s orderService) PreviewOrder(ctx context.Context, accountID string, c Checkout, products []OrderedProduct) (*Order, error) {
 	o := &Order{
-		ID:        ksuid.New().String(),
-		CreatedAt: time.Now().UTC(),
-		AccountID: accountID,
-		Products:  products,
+		CreatedAt:       time.Now().UTC(),
+		AccountID:       accountID,
+		TaxRegion:       normalizeRegion(c.taxRegion()),
+		ShippingAddress: c.ShippingAddress,
+		Products:        products,
+	}
+
+	for _, p := range products {
+		line, err := p.Price.Mul(int64(p.Quantity))
+
+		if err != nil {
+			return nil, err
+		}
+
+		subtotal, err := o.Subtotal.Add(line)
+
+		if err != nil {
+			return nil, err
+		}
+
+		o.Subtotal = subtotal
+	}
+
+	o.TotalPrice = o.Subtotal
+
+	if c.CouponCode != "" {
+		d, err := s.applyCoupon(ctx, o, c.CouponCode)
+
+		if err != nil {
+			return nil, err
+		}
+
+		o.Discounts = []Discount{*d}
+
+		if o.TotalPrice, err = o.TotalPrice.Sub(d.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.applyTax(ctx, o); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func (s orderService) applyCoupon(ctx context.Context, o *Order, couponCode string) (*Discount, error) {
+	code := NormalizeCouponCode(couponCode)
+	c, err := s.repository.GetCoupon(ctx, code)
+
+	if err != nil {
+		return nil, err
+	}
+
+	uses, err := s.repository.CountCouponUses(ctx, code, o.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Apply(o.Products, o.Subtotal, o.CreatedAt, uses)
+}
+
+// applyTax computes the tax of every line and adds it to the order's total.
+// Discounts are spread over the lines in proportion to their price, so each
+// line is taxed on what is actually paid for it. Orders the tax rules don't
+// cover are handled as the tax policy says.
+func (s orderService) applyTax(ctx context.Context, o *Order) error {
+	o.Tax = money.New(0, o.Subtotal.Currency)
+
+	for i := range o.Products {
+		o.Products[i].Tax = o.Tax
+	}
+
+	if o.TaxRegion == "" {
+		o.TaxRegion = normalizeRegion(s.taxPolicy.DefaultRegion)
+	}
+
+	if o.TaxRegion == "" {
+		if s.taxPolicy.Strict {
+			return ErrMissingTaxRegion
+		}
+
+		return nil
+	}
+
+	taxes := make([]money.Money, len(o.Products))
+
+	// Lines aren't taxed yet, so their totals are their net prices
+	for i, net := range o.lineTotals() {
+		tax, err := s.tax.Tax(ctx, o.TaxRegion, o.Products[i].TaxCategory, money.New(net, o.Subtotal.Currency))
+
+		if errors.Is(err, ErrUnknownTaxRegion) && !s.taxPolicy.Strict {
+			o.TaxRegion = ""
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		taxes[i] = tax
+	}
+
+	for i, tax := range taxes {
+		o.Products[i].Tax = tax
+
+		var err error
+
+		if o.Tax, err = o.Tax.Add(tax); err != nil {
+			return err
+		}
+	}
+
+	total, err := o.TotalPrice.Add(o.Tax)
+
+	if err != nil {
+		return err
 	}
 
-	o.TotalPrice = 0.0
+	o.TotalPrice = total
+
+	return nil
+}
+
+// GetIdempotentOrder returns the order the account placed with the given
+// idempotency key, or ErrNotFound if there is none. ErrIdempotencyConflict
+// means the key was used for different products.
+func (s orderService) GetIdempotentOrder(ctx context.Context, accountID, idempotencyKey string, c Checkout, products []OrderedProduct) (*Order, error) {
+	o, fingerprint, err := s.repository.GetOrderByIdempotencyKey(ctx, accountID, idempotencyKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if fingerprint != payloadFingerprint(c, products) {
+		return nil, ErrIdempotencyConflict
+	}
+
+	return o, nil
+}
+
+// GetOrderByIdempotencyKey returns the order the account placed with the
+// given idempotency key, or ErrNotFound if there is none, without comparing
+// it to a request. A checkout clears the cart it was placed from, so its
+// retries can't be compared.
+func (s orderService) GetOrderByIdempotencyKey(ctx context.Context, accountID, idempotencyKey string) (*Order, error) {
+	o, _, err := s.repository.GetOrderByIdempotencyKey(ctx, accountID, idempotencyKey)
+
+	return o, err
+}
+
+// payloadFingerprint hashes the checkout options, products and quantities of
+// an order request, regardless of the order the products were listed in.
+// Saved addresses are hashed by their ID, so retries can be compared before
+// the address is looked up, while inline ones are hashed field by field.
+func payloadFingerprint(c Checkout, products []OrderedProduct) string {
+	lines := make([]string, 0, len(products))
 
 	for _, p := range products {
-		o.TotalPrice += p.Price * float64(p.Quantity)
+		lines = append(lines, fmt.Sprintf("%s:%d\n", p.ID, p.Quantity))
+	}
+
+	sort.Strings(lines)
+
+	h := sha256.New()
+	h.Write([]byte(c.Currency + "\n" + normalizeRegion(c.Region) + "\n" + NormalizeCouponCode(c.CouponCode) + "\n"))
+
+	switch a := c.ShippingAddress; {
+	case a != nil && a.ID != "":
+		fmt.Fprintf(h, "address %q\n", a.ID)
+	case a != nil:
+		fmt.Fprintf(h, "%q %q %q %q %q %q %q\n", a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country)
+	}
+
+	for _, l := range lines {
+		h.Write([]byte(l))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RecordStockFailure keeps a stock operation the catalog failed to apply, so
+// it can be settled by hand.
+func (s orderService) RecordStockFailure(ctx context.Context, orderID string, op StockOperation, cause error) error {
+	return s.repository.PutStockFailure(ctx, StockFailure{
+		OrderID:   orderID,
+		Operation: op,
+		Error:     cause.Error(),
+		FailedAt:  time.Now().UTC(),
+	})
+}
+
+func (s orderService) GetOrder(ctx context.Context, id string) (*Order, error) {
+	return s.repository.GetOrderByID(ctx, id)
+}
+
+// TransitionOrder moves an order to a new status by hand if the transition
+// table allows it, recording the change in the order's status history.
+// Orders are paid by PayOrder, so they can only be marked paid by hand once
+// their payment was captured, e.g. if PayOrder failed to update the order.
+// Likewise, orders are only marked refunded once their payment was refunded
+// in full. Cancelling goes through CancelOrder, which refunds the payment.
+func (s orderService) TransitionOrder(ctx context.Context, id string, to Status, actor string) (*Order, error) {
+	if to == StatusCancelled {
+		return s.CancelOrder(ctx, id, manualCancelReason, actor)
+	}
+
+	if to == StatusPaid || to == StatusRefunded {
+		o, err := s.repository.GetOrderByID(ctx, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case to == StatusPaid && (o.Payment == nil || o.Payment.Status != PaymentCaptured):
+			return nil, fmt.Errorf("%w: order has no captured payment", ErrInvalidTransition)
+		case to == StatusRefunded && o.Payment != nil && o.Payment.Status != PaymentRefunded:
+			return nil, fmt.Errorf("%w: order's payment isn't refunded, use RefundOrderLines", ErrInvalidTransition)
+		case to == StatusRefunded && o.Payment == nil && !o.TotalPrice.IsZero():
+			return nil, fmt.Errorf("%w: order has no payment to refund", ErrInvalidTransition)
+		}
 	}
 
-	err := s.repository.PutOrder(ctx, *o)
+	return s.transition(ctx, id, to, actor, "")
+}
+
+// manualCancelReason is recorded for orders cancelled with TransitionOrder,
+// which takes no reason.
+const manualCancelReason = "cancelled by an admin"
+
+func (s orderService) transition(ctx context.Context, id string, to Status, actor, reason string) (*Order, error) {
+	o, err := s.repository.GetOrderByID(ctx, id)
 
 	if err != nil {
 		return nil, err
 	}
+
+	if !o.Status.CanTransitionTo(to) {
+		return nil, ErrInvalidTransition
+	}
+
+	change := StatusChange{
+		Status:    to,
+		ChangedAt: time.Now().UTC(),
+		Actor:     actor,
+		Reason:    reason,
+	}
+
+	if err = s.repository.TransitionOrder(ctx, id, o.Status, change); err != nil {
+		return nil, err
+	}
+
+	o.Status = to
+	o.StatusHistory = append(o.StatusHistory, change)
+
 	return o, nil
 }
 
-func (s orderService) GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error) {
-	return s.repository.GetOrdersForAccount(ctx, accountID)
+// GetOrdersForAccount returns a page of the account's orders matching the
+// filter. TotalCount is the number of matching orders across all pages.
+func (s orderService) GetOrdersForAccount(ctx context.Context, accountID string, f OrderFilter) (*OrderPage, error) {
+	f, err := f.normalize()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra order tells whether another page follows
+	query := f
+	query.Take++
+
+	orders, err := s.repository.GetOrdersForAccount(ctx, accountID, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.repository.CountOrdersForAccount(ctx, accountID, f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newOrderPage(orders, f.Take, total), nil
+}
+
+// GetOrdersForAccounts is the batched form of GetOrdersForAccount, applying
+// the same filter to every account. Every requested account gets a page,
+// even if it has no orders.
+func (s orderService) GetOrdersForAccounts(ctx context.Context, accountIDs []string, f OrderFilter) (map[string]*OrderPage, error) {
+	f, err := f.normalize()
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := f
+	query.Take++
+
+	orders, err := s.repository.GetOrdersForAccounts(ctx, accountIDs, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.repository.CountOrdersForAccounts(ctx, accountIDs, f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byAccount := map[string][]Order{}
+
+	for _, o := range orders {
+		byAccount[o.AccountID] = append(byAccount[o.AccountID], o)
+	}
+
+	pages := map[string]*OrderPage{}
+
+	for _, id := range accountIDs {
+		pages[id] = newOrderPage(byAccount[id], f.Take, counts[id])
+	}
+
+	return pages, nil
+}
+
+// newOrderPage builds a page of at most take orders out of the orders
+// fetched, which include the first order of the next page, if any.
+func newOrderPage(orders []Order, take, total uint64) *OrderPage {
+	page := &OrderPage{Orders: []Order{}, TotalCount: total}
+
+	if uint64(len(orders)) > take {
+		orders = orders[:take]
+		page.NextCursor = encodeCursor(orders[len(orders)-1])
+	}
+
+	for _, o := range orders {
+		page.Orders = append(page.Orders, o)
+		page.Cursors = append(page.Cursors, encodeCursor(o))
+	}
+
+	return page
+}
+
+func (s orderService) CreateCoupon(ctx context.Context, c Coupon) (*Coupon, error) {
+	c.Code = NormalizeCouponCode(c.Code)
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.PutCoupon(ctx, c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// GetCart returns the items in the account's cart, without their catalog
+// details.
+func (s orderService) GetCart(ctx context.Context, accountID string) (*Cart, error) {
+	items, err := s.repository.GetCartItems(ctx, accountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cart{AccountID: accountID, Items: items}, nil
+}
+
+// SetCartItem sets the quantity of a product in the cart, adding it if it
+// isn't in the cart yet. A zero quantity removes the product.
+func (s orderService) SetCartItem(ctx context.Context, accountID, productID string, quantity uint32) error {
+	if quantity == 0 {
+		return s.repository.DeleteCartItem(ctx, accountID, productID)
+	}
+
+	cart, err := s.GetCart(ctx, accountID)
+
+	if err != nil {
+		return err
+	}
+
+	if cart.quantity(productID) == 0 && len(cart.Items) >= maxCartItems {
+		return ErrCartFull
+	}
+
+	return s.repository.PutCartItem(ctx, accountID, CartItem{
+		ProductID: productID,
+		Quantity:  quantity,
+		AddedAt:   time.Now().UTC(),
+	})
+}
+
+// RemoveCartItems removes checked out items from the cart.
+func (s orderService) RemoveCartItems(ctx context.Context, accountID string, items []CartItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	return s.repository.RemoveCartItems(ctx, accountID, items)
+}
+
+// settleTimeout bounds the steps of a payment after the amount was
+// authorized. They run detached from the request, since the provider holds
+// the customer's money at that point whether the request is still waiting or
+// not.
+const settleTimeout = 30 * time.Second
+
+// PayOrder authorizes and captures the total of a pending order with the
+// payment token and moves the order to paid. If the capture fails the
+// authorization is voided and the order stays pending, so it can be paid
+// again. A failed void is recorded as PaymentVoidFailed, which blocks paying
+// again until the authorization was released by hand.
+func (s orderService) PayOrder(ctx context.Context, id, token, actor string) (*Order, error) {
+	o, err := s.repository.GetOrderByID(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !o.Status.CanTransitionTo(StatusPaid) {
+		return nil, ErrInvalidTransition
+	}
+
+	// Nothing to charge, e.g. the order was fully discounted
+	if o.TotalPrice.IsZero() {
+		return s.transition(ctx, id, StatusPaid, actor, "")
+	}
+
+	now := time.Now().UTC()
+	p := Payment{
+		OrderID:   o.ID,
+		Provider:  s.payments.Name(),
+		Status:    PaymentPending,
+		Amount:    o.TotalPrice,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err = s.repository.StartPayment(ctx, p); err != nil {
+		return nil, err
+	}
+
+	reference, err := s.payments.Authorize(ctx, o.ID, token, p.Amount)
+
+	if err != nil {
+		s.updatePayment(context.WithoutCancel(ctx), o.ID, PaymentDeclined, "")
+		return nil, fmt.Errorf("%w: %v", ErrPaymentDeclined, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), settleTimeout)
+
+	defer cancel()
+
+	s.updatePayment(ctx, o.ID, PaymentAuthorized, reference)
+
+	if err = s.payments.Capture(ctx, reference, p.Amount); err != nil {
+		if voidErr := s.payments.Void(ctx, reference); voidErr != nil {
+			log.Println("Error voiding payment:", voidErr)
+			s.updatePayment(ctx, o.ID, PaymentVoidFailed, reference)
+			return nil, fmt.Errorf("%w: %v", ErrPaymentFailed, err)
+		}
+
+		s.updatePayment(ctx, o.ID, PaymentVoided, reference)
+		return nil, fmt.Errorf("%w: %v", ErrPaymentFailed, err)
+	}
+
+	s.updatePayment(ctx, o.ID, PaymentCaptured, reference)
+
+	paid, err := s.transition(ctx, id, StatusPaid, actor, "")
+
+	// The order changed status meanwhile, e.g. it was cancelled, so the
+	// money goes back
+	if err != nil {
+		p.Reference = reference
+		p.Status = PaymentCaptured
+		o.Payment = &p
+
+		if refundErr := s.refund(ctx, o, o.unrefundedLines(), "order changed status during payment", actor); refundErr != nil {
+			log.Println("Error refunding payment:", refundErr)
+		}
+
+		return nil, err
+	}
+
+	return paid, nil
+}
+
+// updatePayment records the progress of a payment. The provider has already
+// moved the money at this point, so failures are logged rather than undone.
+func (s orderService) updatePayment(ctx context.Context, orderID string, status PaymentStatus, reference string) {
+	if err := s.repository.UpdatePayment(ctx, orderID, status, reference); err != nil {
+		log.Println("Error updating payment:", err)
+	}
+}
+
+// CancelOrder cancels an order that hasn't shipped yet and refunds whatever
+// is left of its captured payment. The order is cancelled before the refund,
+// so a payment completing meanwhile refunds itself. The order stays
+// cancelled if the refund fails, the failed refund is kept with it and can
+// be retried with RefundOrderLines.
+func (s orderService) CancelOrder(ctx context.Context, id, reason, actor string) (*Order, error) {
+	if len(reason) > maxReasonLength {
+		return nil, fmt.Errorf("%w: reason is too long", ErrInvalidRefund)
+	}
+
+	o, err := s.transition(ctx, id, StatusCancelled, actor, reason)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p := o.Payment; p != nil && p.Status == PaymentCaptured {
+		if lines := o.unrefundedLines(); len(lines) > 0 {
+			if err = s.refund(ctx, o, lines, reason, actor); err != nil {
+				log.Println("Error refunding cancelled order:", err)
+			}
+		}
+	}
+
+	return s.repository.GetOrderByID(ctx, id)
+}
+
+// RefundOrderLines refunds the given quantities of an order's lines. Each
+// line is refunded its share of what was charged for it, including tax and
+// net of discounts. The order keeps its status.
+func (s orderService) RefundOrderLines(ctx context.Context, id string, lines []RefundLine, reason, actor string) (*Order, error) {
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: no lines to refund", ErrInvalidRefund)
+	}
+
+	if len(reason) > maxReasonLength {
+		return nil, fmt.Errorf("%w: reason is too long", ErrInvalidRefund)
+	}
+
+	o, err := s.repository.GetOrderByID(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Payment == nil || o.Payment.Status != PaymentCaptured {
+		return nil, ErrNotRefundable
+	}
+
+	left := o.refundableQuantities()
+	seen := map[string]bool{}
+
+	for _, l := range lines {
+		q, ok := left[l.ProductID]
+
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("%w: product %s isn't part of the order", ErrInvalidRefund, l.ProductID)
+		case l.Quantity == 0 || seen[l.ProductID]:
+			return nil, fmt.Errorf("%w: product %s must be listed once with a quantity", ErrInvalidRefund, l.ProductID)
+		case l.Quantity > q:
+			return nil, fmt.Errorf("%w: only %d of product %s left to refund", ErrRefundExceeded, q, l.ProductID)
+		}
+
+		seen[l.ProductID] = true
+	}
+
+	if err = s.refund(ctx, o, lines, reason, actor); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetOrderByID(ctx, id)
+}
+
+// refund gives back the given quantities of the order's lines. Shares of
+// lines are rounded down, except for the refund that completes the order,
+// which takes whatever is left of the payment. The payment is marked
+// refunded once all of it was given back.
+func (s orderService) refund(ctx context.Context, o *Order, lines []RefundLine, reason, actor string) error {
+	currency := o.Payment.Amount.Currency
+	requested := map[string]uint32{}
+
+	for _, l := range lines {
+		requested[l.ProductID] = l.Quantity
+	}
+
+	refundLines, amount, complete := o.refundLines(requested)
+
+	r := Refund{
+		ID:        ksuid.New().String(),
+		OrderID:   o.ID,
+		Status:    RefundPending,
+		Amount:    money.New(amount, currency),
+		Reason:    reason,
+		Actor:     actor,
+		Lines:     refundLines,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := s.repository.PutRefund(ctx, r); err != nil {
+		return err
+	}
+
+	// Lines can be free, e.g. with buy x get y coupons
+	if r.Amount.Amount > 0 {
+		reference, err := s.payments.Refund(ctx, o.Payment.Reference, r.Amount)
+
+		if err != nil {
+			s.updateRefund(ctx, r.ID, RefundFailed, "")
+			return fmt.Errorf("%w: %v", ErrRefundFailed, err)
+		}
+
+		r.Reference = reference
+	}
+
+	s.updateRefund(ctx, r.ID, RefundSucceeded, r.Reference)
+
+	if complete {
+		s.updatePayment(ctx, o.ID, PaymentRefunded, o.Payment.Reference)
+	}
+
+	return nil
+}
+
+// updateRefund records the outcome of a refund. Like updatePayment, it only
+// logs failures.
+func (s orderService) updateRefund(ctx context.Context, id string, status RefundStatus, reference string) {
+	if err := s.repository.UpdateRefund(ctx, id, status, reference); err != nil {
+		log.Println("Error updating refund:", err)
+	}
 }
@@ -0,0 +1,67 @@
+package order
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidStatus     = errors.New("invalid order status")
+	ErrInvalidTransition = errors.New("order status transition not allowed")
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusPaid      Status = "paid"
+	StatusFulfilled Status = "fulfilled"
+	StatusCancelled Status = "cancelled"
+	StatusRefunded  Status = "refunded"
+)
+
+// transitions lists the statuses an order can move to from each status.
+// Cancelled and refunded orders are final.
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusFulfilled, StatusCancelled, StatusRefunded},
+	StatusFulfilled: {StatusRefunded},
+}
+
+func ParseStatus(s string) (Status, error) {
+	switch status := Status(s); status {
+	case StatusPending, StatusPaid, StatusFulfilled, StatusCancelled, StatusRefunded:
+		return status, nil
+	}
+
+	return "", ErrInvalidStatus
+}
+
+func (s Status) CanTransitionTo(to Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StatusChange is an entry of an order's status history. Actor is the ID of
+// the account that made the change, Reason why it was made, if given.
+type StatusChange struct {
+	Status    Status
+	ChangedAt time.Time
+	Actor     string
+	Reason    string
+}
+
+func (o Order) wasFulfilled() bool {
+	for _, c := range o.StatusHistory {
+		if c.Status == StatusFulfilled {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,152 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+var (
+	ErrUnknownTaxRegion = errors.New("no tax rules for region")
+	ErrMissingTaxRegion = errors.New("a region or a shipping address is required")
+	ErrInvalidTaxRule   = errors.New("invalid tax rule")
+)
+
+// TaxCalculator computes the tax owed on an order line. amount is the price
+// of the line after discounts, category the tax category of the product.
+type TaxCalculator interface {
+	Tax(ctx context.Context, region, category string, amount money.Money) (money.Money, error)
+}
+
+// anyCategory matches the categories of a region that have no rule of their
+// own.
+const anyCategory = "*"
+
+// TaxRule is the rate of a product tax category in a region, in basis
+// points, e.g. 1925 for 19.25%.
+type TaxRule struct {
+	Region   string
+	Category string
+	Rate     uint32
+}
+
+// TaxPolicy decides how orders are taxed that the tax rules don't cover.
+// Orders without a region are taxed in DefaultRegion. Orders that still have
+// none, or one without rules, are rejected if Strict is set, and otherwise
+// placed untaxed, without a region.
+type TaxPolicy struct {
+	DefaultRegion string
+	Strict        bool
+}
+
+// RuleTable is a TaxCalculator looking rates up in a fixed table of rules.
+type RuleTable struct {
+	rates   map[string]uint32
+	regions map[string]bool
+}
+
+func NewRuleTable(rules []TaxRule) *RuleTable {
+	t := &RuleTable{rates: map[string]uint32{}, regions: map[string]bool{}}
+
+	for _, rule := range rules {
+		region := normalizeRegion(rule.Region)
+		t.rates[region+"/"+strings.ToLower(rule.Category)] = rule.Rate
+		t.regions[region] = true
+	}
+
+	return t
+}
+
+// Tax rounds half up to the minor unit of the currency. Categories without
+// a rule of their own and no catch-all rule in the region are untaxed.
+func (t *RuleTable) Tax(ctx context.Context, region, category string, amount money.Money) (money.Money, error) {
+	region = normalizeRegion(region)
+
+	// Subdivisions without rules of their own are taxed like their country
+	if country, _, ok := strings.Cut(region, "-"); ok && !t.regions[region] {
+		region = country
+	}
+
+	if !t.regions[region] {
+		return money.Money{}, fmt.Errorf("%w: %q", ErrUnknownTaxRegion, region)
+	}
+
+	rate, ok := t.rates[region+"/"+strings.ToLower(category)]
+
+	if !ok {
+		rate = t.rates[region+"/"+anyCategory]
+	}
+
+	scaled, err := amount.Mul(int64(rate))
+
+	if err == nil {
+		scaled, err = scaled.Add(money.New(5000, amount.Currency))
+	}
+
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return money.New(scaled.Amount/10000, amount.Currency), nil
+}
+
+func normalizeRegion(region string) string {
+	return strings.ToUpper(strings.TrimSpace(region))
+}
+
+// ParseTaxRules reads a comma separated list of region:category:percent
+// rules, e.g. "DE:standard:19,DE:reduced:7,US-CA:*:7.25". A category of *
+// applies to every category of the region without a rule of its own.
+func ParseTaxRules(s string) ([]TaxRule, error) {
+	rules := []TaxRule{}
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+
+		if field == "" {
+			continue
+		}
+
+		parts := strings.Split(field, ":")
+
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTaxRule, field)
+		}
+
+		rate, err := parsePercent(parts[2])
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTaxRule, field)
+		}
+
+		rules = append(rules, TaxRule{Region: parts[0], Category: parts[1], Rate: rate})
+	}
+
+	return rules, nil
+}
+
+// parsePercent converts a percentage with at most two decimal places to
+// basis points.
+func parsePercent(s string) (uint32, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+
+	if whole == "" || len(frac) > 2 {
+		return 0, strconv.ErrSyntax
+	}
+
+	bp, err := strconv.ParseUint(whole+frac+strings.Repeat("0", 2-len(frac)), 10, 32)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if bp > 10000 {
+		return 0, strconv.ErrRange
+	}
+
+	return uint32(bp), nil
+}
@@ -0,0 +1,58 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/azizkhan030/go-grpc-graphql/money"
+)
+
+func TestRuleTableTax(t *testing.T) {
+	rules, err := ParseTaxRules("DE:standard:19,DE:reduced:7,US:*:5,US-CA:*:7.25")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := NewRuleTable(rules)
+
+	tests := []struct {
+		name     string
+		region   string
+		category string
+		amount   int64
+		want     int64
+		wantErr  error
+	}{
+		{name: "standard rate", region: "DE", category: "standard", amount: 1000, want: 190},
+		{name: "reduced rate", region: "DE", category: "reduced", amount: 1000, want: 70},
+		{name: "region and category are normalized", region: " de ", category: "Standard", amount: 1000, want: 190},
+		{name: "category without a rule is untaxed", region: "DE", category: "books", amount: 1000, want: 0},
+		{name: "subdivision falls back to its country", region: "DE-BY", category: "standard", amount: 1000, want: 190},
+		{name: "subdivision rule before its country's", region: "US-CA", category: "standard", amount: 1000, want: 73},
+		{name: "catch-all rule of the country", region: "US-NY", category: "standard", amount: 1000, want: 50},
+		{name: "basis points round half up", region: "US", category: "standard", amount: 10, want: 1},
+		{name: "basis points below half round down", region: "DE", category: "standard", amount: 2, want: 0},
+		{name: "fractional rate rounds down", region: "US-CA", category: "standard", amount: 999, want: 72},
+		{name: "fractional rate rounds up", region: "US-CA", category: "standard", amount: 1001, want: 73},
+		{name: "unknown region", region: "FR", category: "standard", amount: 1000, wantErr: ErrUnknownTaxRegion},
+		{name: "subdivision of an unknown region", region: "FR-IDF", category: "standard", amount: 1000, wantErr: ErrUnknownTaxRegion},
+		{name: "overflow", region: "DE", category: "standard", amount: math.MaxInt64 / 1000, wantErr: money.ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := table.Tax(context.Background(), tt.region, tt.category, money.New(tt.amount, "EUR"))
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Tax() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && got != money.New(tt.want, "EUR") {
+				t.Errorf("Tax() = %+v, want %d EUR", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,149 @@ CREATE TABLE IF NOT EXISTS orders (
     id CHAR(27) PRIMARY KEY,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL,
     account_id CHAR(27) NOT NULL,
-    total_price MONEY NOT NULL
+    subtotal BIGINT NOT NULL,
+    tax BIGINT NOT NULL DEFAULT 0,
+    total_price BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    tax_region VARCHAR(16),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    idempotency_key VARCHAR(255),
+    fingerprint CHAR(64),
+    CONSTRAINT orders_idempotency_key UNIQUE (account_id, idempotency_key)
 );
 
-CREATE TABLE IF NOT EXISTS order_items (
-    oder_id CHAR(27) REFERENCES orders (id) ON DELETE CASCADE,
+CREATE INDEX IF NOT EXISTS orders_account_id_idx ON orders (account_id);
+CREATE INDEX IF NOT EXISTS orders_account_id_currency_total_price_idx ON orders (account_id, currency, total_price, id);
+
+-- name, price, currency and tax_category are snapshots taken when the order
+-- is placed. Prices and tax are in the minor units of the currency, tax
+-- being the tax on the whole line. exchange_rate is set if the price was
+-- converted from another currency.
+CREATE TABLE IF NOT EXISTS order_products (
+    order_id CHAR(27) REFERENCES orders (id) ON DELETE CASCADE,
     product_id CHAR(27),
     quantity INT NOT NULL,
+    name TEXT NOT NULL,
+    price BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    exchange_rate NUMERIC,
+    tax_category VARCHAR(64) NOT NULL DEFAULT 'standard',
+    tax BIGINT NOT NULL DEFAULT 0,
     PRIMARY KEY (product_id, order_id)
-);
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id CHAR(27) NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    actor CHAR(27) NOT NULL,
+    reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_id_idx ON order_status_history (order_id);
+
+-- currency applies to both amount and min_order_value
+CREATE TABLE IF NOT EXISTS coupons (
+    code VARCHAR(64) PRIMARY KEY,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('percentage', 'fixed', 'buy_x_get_y')),
+    percent INT NOT NULL DEFAULT 0,
+    amount BIGINT NOT NULL DEFAULT 0,
+    currency CHAR(3),
+    product_id CHAR(27),
+    buy_quantity INT NOT NULL DEFAULT 0,
+    free_quantity INT NOT NULL DEFAULT 0,
+    min_order_value BIGINT NOT NULL DEFAULT 0,
+    usage_limit INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS order_discounts (
+    id BIGSERIAL PRIMARY KEY,
+    order_id CHAR(27) NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    coupon_code VARCHAR(64) NOT NULL REFERENCES coupons (code),
+    description TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS order_discounts_order_id_idx ON order_discounts (order_id);
+CREATE INDEX IF NOT EXISTS order_discounts_coupon_code_idx ON order_discounts (coupon_code);
+
+-- Snapshot of the address an order ships to, so later edits to the address
+-- book don't change it. address_id is the entry it was copied from, if any.
+CREATE TABLE IF NOT EXISTS order_addresses (
+    order_id CHAR(27) PRIMARY KEY REFERENCES orders (id) ON DELETE CASCADE,
+    address_id CHAR(27),
+    name VARCHAR(100) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL,
+    city VARCHAR(100) NOT NULL,
+    region VARCHAR(16) NOT NULL,
+    postal_code VARCHAR(16) NOT NULL,
+    country CHAR(2) NOT NULL
+);
+
+-- One cart per account. Prices aren't stored, carts are priced from the
+-- catalog whenever they are read.
+CREATE TABLE IF NOT EXISTS cart_items (
+    account_id CHAR(27) NOT NULL,
+    product_id CHAR(27) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    added_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (account_id, product_id)
+);
+
+-- At most one payment per order. A declined or voided payment is replaced
+-- when the order is paid again, a void_failed one has to be released with
+-- the provider and updated by hand first. reference is the payment
+-- provider's reference of the authorization.
+CREATE TABLE IF NOT EXISTS payments (
+    order_id CHAR(27) PRIMARY KEY REFERENCES orders (id) ON DELETE CASCADE,
+    provider VARCHAR(32) NOT NULL,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'authorized', 'captured', 'declined', 'voided', 'refunded', 'void_failed')),
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Refunds of an order's payment. Failed refunds are kept for the record but
+-- don't count towards the refunded amount. reference is the payment
+-- provider's reference of the refund.
+CREATE TABLE IF NOT EXISTS refunds (
+    id CHAR(27) PRIMARY KEY,
+    order_id CHAR(27) NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'succeeded', 'failed')),
+    amount BIGINT NOT NULL CHECK (amount >= 0),
+    currency CHAR(3) NOT NULL,
+    reason TEXT NOT NULL,
+    actor CHAR(27) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS refunds_order_id_idx ON refunds (order_id);
+
+-- amount is the line's share of the refund, in the refund's currency
+CREATE TABLE IF NOT EXISTS refund_lines (
+    refund_id CHAR(27) NOT NULL REFERENCES refunds (id) ON DELETE CASCADE,
+    product_id CHAR(27) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    amount BIGINT NOT NULL,
+    PRIMARY KEY (refund_id, product_id)
+);
+
+-- Stock the catalog failed to commit or release for an order. Stock calls
+-- aren't idempotent, so they aren't retried, each failure has to be settled
+-- with the catalog by hand.
+CREATE TABLE IF NOT EXISTS stock_failures (
+    id BIGSERIAL PRIMARY KEY,
+    order_id CHAR(27) NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    operation VARCHAR(16) NOT NULL CHECK (operation IN ('commit', 'release')),
+    error TEXT NOT NULL,
+    failed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS stock_failures_order_id_idx ON stock_failures (order_id);